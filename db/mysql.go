@@ -6,17 +6,25 @@ import (
 	"errors"
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/J-guanghua/rwlock"
 )
 
+// 未设置 Expiry 时检查持锁会话的间隔
+const checkInterval = 3 * time.Second
+
+// Lock 每次 GET_LOCK 等待的秒数
+const lockWait = 4
+
 type rwMysql struct {
 	db     *sql.DB
-	name   string
+	name   rwlock.Name
 	sema   uint32
 	wait   int32
 	opts   *rwlock.Options
 	signal chan struct{}
+	cancel context.CancelFunc
 }
 
 func (rw *rwMysql) getOptions(ctx context.Context) *rwlock.Options {
@@ -31,7 +39,7 @@ func (rw *rwMysql) Lock(ctx context.Context) error {
 	options := rw.getOptions(ctx)
 	if rw.sema == 1 || rw.wait > 0 {
 		rw.notify(rwlock.GetGoroutineID())
-	} else if err = rw.acquireLock(ctx); err == nil {
+	} else if err = rw.acquireLock(ctx, lockWait); err == nil {
 		return nil
 	} else if !errors.Is(err, rwlock.ErrFailed) {
 		return err
@@ -44,10 +52,10 @@ LoopLock:
 		return ctx.Err()
 	case <-rw.signal:
 		tries++
-		err = rw.acquireLock(ctx)
+		err = rw.acquireLock(ctx, lockWait)
 		if errors.Is(err, rwlock.ErrFailed) {
 			if options.Tries > 0 && tries >= options.Tries {
-				return fmt.Errorf("尝试 %d 次,获取锁失败", tries)
+				return fmt.Errorf("尝试 %d 次,获取锁失败: %w", tries, rwlock.ErrFailed)
 			}
 			goto LoopLock
 		} else if err != nil {
@@ -58,14 +66,32 @@ LoopLock:
 }
 
 func (rw *rwMysql) Unlock(ctx context.Context) error {
+	if rw.cancel != nil {
+		rw.cancel()
+	}
 	defer rw.notify(rwlock.GetGoroutineID())
 	defer atomic.StoreUint32(&rw.sema, 0)
 	_ = atomic.AddInt32(&rw.wait, -1)
 	return rw.releaseUnlock(ctx)
 }
 
-func (rw *rwMysql) acquireLock(ctx context.Context) error {
-	row, err := rw.db.QueryContext(ctx, "SELECT GET_LOCK(?,?)", rw.name, 4)
+// 不等待地尝试一次, 本进程或其他会话持有时返回 rwlock.ErrFailed
+// GET_LOCK 在同一会话内可重入, 先占用 sema 避免进程内重复获取
+func (rw *rwMysql) tryLock(ctx context.Context) error {
+	if !atomic.CompareAndSwapUint32(&rw.sema, 0, 1) {
+		return rwlock.ErrFailed
+	}
+	err := rw.acquireLock(ctx, 0)
+	if err != nil {
+		atomic.StoreUint32(&rw.sema, 0)
+		rw.notify(rwlock.GetGoroutineID())
+	}
+	return err
+}
+
+// timeout 为 GET_LOCK 等待的秒数, 等待期间独占数据库唯一的连接
+func (rw *rwMysql) acquireLock(ctx context.Context, timeout int) error {
+	row, err := rw.db.QueryContext(ctx, "SELECT GET_LOCK(?,?)", rw.name.Key, timeout)
 	if err != nil {
 		return err
 	}
@@ -77,6 +103,8 @@ func (rw *rwMysql) acquireLock(ctx context.Context) error {
 			return err
 		} else if result == 1 {
 			atomic.StoreUint32(&rw.sema, 1)
+			ctx, rw.cancel = context.WithCancel(ctx)
+			go rw.watchSession(&rwlock.Renewal{Ctx: ctx, Name: rw.name.Original, Cancel: rw.cancel})
 			return nil
 		} else if rw.sema == 0 {
 			rw.notify(rwlock.GetGoroutineID())
@@ -88,7 +116,7 @@ func (rw *rwMysql) acquireLock(ctx context.Context) error {
 
 func (rw *rwMysql) releaseUnlock(ctx context.Context) error {
 	// 释放锁
-	row, err := rw.db.QueryContext(ctx, "SELECT RELEASE_LOCK(?)", rw.name)
+	row, err := rw.db.QueryContext(ctx, "SELECT RELEASE_LOCK(?)", rw.name.Key)
 	if err != nil {
 		return err
 	}
@@ -107,6 +135,38 @@ func (rw *rwMysql) releaseUnlock(ctx context.Context) error {
 	return row.Err()
 }
 
+// 会话断开时 MySQL 会静默释放锁, 定期确认锁仍由当前会话持有
+// 检查失败时通知 OnRenewal 并取消持锁上下文
+func (rw *rwMysql) watchSession(renewal *rwlock.Renewal) {
+	opts := rw.getOptions(renewal.Ctx)
+	interval := opts.Expiry
+	if interval <= 0 {
+		interval = checkInterval
+	}
+	renewal.Value = opts.Value
+	for {
+		select {
+		case <-renewal.Ctx.Done():
+			return
+		case <-time.After(interval):
+			var held sql.NullBool
+			renewal.Err = rw.db.QueryRowContext(renewal.Ctx,
+				"SELECT IS_USED_LOCK(?) = CONNECTION_ID()", rw.name.Key).Scan(&held)
+			if renewal.Ctx.Err() != nil {
+				return
+			}
+			renewal.Result = renewal.Err == nil && held.Bool
+			if opts.OnRenewal != nil {
+				opts.OnRenewal(renewal)
+			}
+			if !renewal.Result {
+				renewal.Cancel()
+				return
+			}
+		}
+	}
+}
+
 func (rw *rwMysql) notify(_ int64) {
 	for i := 0; i <= len(rw.signal); i++ {
 		select {
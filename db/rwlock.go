@@ -1,8 +1,10 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"sync"
+	"sync/atomic"
 
 	"github.com/J-guanghua/rwlock"
 )
@@ -28,19 +30,90 @@ type rwLock struct {
 	mutex map[string]rwlock.Mutex
 }
 
+// 已执行过的建表语句
+var tables sync.Map // table -> struct{}
+
+type table struct {
+	db  *sql.DB
+	ddl string
+}
+
+// *sql.DB、*sql.Conn、*sql.Tx 都可以执行建表语句
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// GET_LOCK 的名称最长 64 个字符
+var namePolicy = rwlock.NamePolicy{Separator: ":", MaxLength: 64}
+
 func (rw *rwLock) allocation(name string, opts *rwlock.Options) rwlock.Mutex {
+	n, err := namePolicy.Normalize(opts.Namespace, name)
+	if err != nil {
+		return rwlock.InvalidMutex(err)
+	}
 	rw.m.Lock()
 	defer rw.m.Unlock()
-	if rw.mutex[name] == nil {
-		index := len(name) % rw.size
-		rw.mutex[name] = &rwMysql{
+	if rw.mutex[n.Key] == nil {
+		index := len(n.Key) % rw.size
+		rw.mutex[n.Key] = &rwMysql{
 			db:     rw.dbs[index],
-			name:   name,
+			name:   n,
 			opts:   opts,
 			signal: make(chan struct{}, 1),
 		}
 	}
-	return rw.mutex[name]
+	return rw.mutex[n.Key]
+}
+
+// 未被本进程持有时从缓存中移除
+func (rw *rwLock) evict(mutex *rwMysql) {
+	rw.m.Lock()
+	defer rw.m.Unlock()
+	if rw.mutex[mutex.name.Key] == mutex && atomic.LoadUint32(&mutex.sema) == 0 {
+		delete(rw.mutex, mutex.name.Key)
+	}
+}
+
+// EnsureTable 在 d 上执行建表语句, 每个数据库的同一语句只成功执行一次
+// 建表期间不持有任何锁, 并发调用时可能重复执行, ddl 应使用 CREATE TABLE IF NOT EXISTS
+func EnsureTable(ctx context.Context, d *sql.DB, ddl string) error {
+	return ensureTable(ctx, d, d, ddl)
+}
+
+// 持有锁的会话独占 d 唯一的连接, 此时需通过 exec 在该会话上执行
+func ensureTable(ctx context.Context, d *sql.DB, exec execer, ddl string) error {
+	key := table{db: d, ddl: ddl}
+	if _, ok := tables.Load(key); ok {
+		return nil
+	}
+	if _, err := exec.ExecContext(ctx, ddl); err != nil {
+		return err
+	}
+	tables.Store(key, struct{}{})
+	return nil
+}
+
+// DB 返回名称对应的锁所在的数据库, 在其上执行的语句与 GET_LOCK 使用同一个会话
+// 名称不合法时返回第一个数据库, 错误由 Key 或 Mutex 的 Lock 返回
+func DB(name string, opts ...rwlock.Option) *sql.DB {
+	ops := &rwlock.Options{}
+	for _, o := range opts {
+		o(ops)
+	}
+	if rw, ok := dlock.allocation(name, ops).(*rwMysql); ok {
+		return rw.db
+	}
+	return dlock.dbs[0]
+}
+
+// Key 返回名称对应的 GET_LOCK 锁名, 过长的名称会被哈希
+func Key(name string, opts ...rwlock.Option) (string, error) {
+	ops := &rwlock.Options{}
+	for _, o := range opts {
+		o(ops)
+	}
+	n, err := namePolicy.Normalize(ops.Namespace, name)
+	return n.Key, err
 }
 
 func Mutex(name string, opts ...rwlock.Option) rwlock.Mutex {
@@ -51,6 +124,44 @@ func Mutex(name string, opts ...rwlock.Option) rwlock.Mutex {
 	return dlock.allocation(name, ops)
 }
 
+// TryLock 以 GET_LOCK(name, 0) 尝试一次获取 Mutex(name) 对应的锁, 不等待其他会话释放
+// 被占用时返回 rwlock.ErrFailed, 获取成功后通过 Mutex(name).Unlock 释放
+func TryLock(ctx context.Context, name string, opts ...rwlock.Option) error {
+	mutex := Mutex(name, opts...)
+	rw, ok := mutex.(*rwMysql)
+	if !ok {
+		return mutex.Lock(ctx)
+	}
+	return rw.tryLock(ctx)
+}
+
+// OnceMutex 与 Mutex 相同, Unlock 或加锁失败后从缓存中移除
+// 适用于只使用一次的锁名称, 如定时任务的每次调度, 移除后不要再使用
+func OnceMutex(name string, opts ...rwlock.Option) rwlock.Mutex {
+	mutex := Mutex(name, opts...)
+	if rw, ok := mutex.(*rwMysql); ok {
+		return onceMutex{rw}
+	}
+	return mutex
+}
+
+type onceMutex struct {
+	*rwMysql
+}
+
+func (m onceMutex) Lock(ctx context.Context) error {
+	err := m.rwMysql.Lock(ctx)
+	if err != nil {
+		dlock.evict(m.rwMysql)
+	}
+	return err
+}
+
+func (m onceMutex) Unlock(ctx context.Context) error {
+	defer dlock.evict(m.rwMysql)
+	return m.rwMysql.Unlock(ctx)
+}
+
 func RWMutex(name string, opts ...rwlock.Option) rwlock.RWMutex { // nolint
 	return nil
 }
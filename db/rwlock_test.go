@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -94,3 +95,97 @@ func BenchmarkRWMutex(b *testing.B) {
 		_ = mutex.Unlock(context.TODO())
 	}
 }
+
+func TestWithLockTx(t *testing.T) {
+	var last int64
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+	defer cancel()
+	for i := 0; i < 10; i++ {
+		err := WithLockTx(ctx, "guanghua-tx", func(tx *sql.Tx) error {
+			fencing, ok := FencingFromTx(tx)
+			if !ok {
+				t.Fatal("缺少栅栏信息")
+			}
+			if fencing.Version <= last {
+				t.Fatalf("栅栏版本未递增: %v <= %v", fencing.Version, last)
+			}
+			last = fencing.Version
+			_, err := tx.ExecContext(ctx, "SELECT 1")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOnceMutex(t *testing.T) {
+	ctx := context.Background()
+	mutex := OnceMutex("guanghua-once", rwlock.WithTries(1))
+	if err := mutex.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := mutex.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	dlock.m.Lock()
+	defer dlock.m.Unlock()
+	if _, ok := dlock.mutex["guanghua-once"]; ok {
+		t.Fatal("释放后应从缓存中移除")
+	}
+}
+
+func TestTryLock(t *testing.T) {
+	ctx := context.Background()
+	if err := TryLock(ctx, "guanghua-try"); err != nil {
+		t.Fatal(err)
+	}
+	// 同一会话内 GET_LOCK 可重入, 进程内已持有时也应失败
+	if err := TryLock(ctx, "guanghua-try"); !errors.Is(err, rwlock.ErrFailed) {
+		t.Fatalf("已持有时应返回 ErrFailed: %v", err)
+	}
+	if err := Mutex("guanghua-try").Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := TryLock(ctx, "guanghua-try"); err != nil {
+		t.Fatal(err)
+	}
+	_ = Mutex("guanghua-try").Unlock(ctx)
+}
+
+func TestSessionLost(t *testing.T) {
+	lost := make(chan *rwlock.Renewal, 1)
+	mutex := Mutex("guanghua-lost", rwlock.WithExpiry(time.Second),
+		rwlock.WithOnRenewal(func(r *rwlock.Renewal) {
+			if !r.Result {
+				lost <- r
+			}
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+	defer cancel()
+	if err := mutex.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer mutex.Unlock(ctx) // nolint
+
+	// 从另一个连接断开持锁会话
+	other, err := sql.Open("mysql", "root:guanghua@tcp(192.168.43.152:3306)/sys?parseTime=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	var id int64
+	if err = other.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?)", "guanghua-lost").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.ExecContext(ctx, fmt.Sprintf("KILL %d", id)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-lost:
+		<-r.Ctx.Done()
+		t.Logf("检测到锁丢失: %v", r.Err)
+	case <-ctx.Done():
+		t.Fatal("未检测到锁丢失")
+	}
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/J-guanghua/rwlock"
+)
+
+// 记录每个锁名的栅栏版本, 每次在事务内成功持有锁后递增
+const fencingTable = `CREATE TABLE IF NOT EXISTS rwlock_fencing (
+	name VARCHAR(64) NOT NULL PRIMARY KEY,
+	version BIGINT UNSIGNED NOT NULL
+)`
+
+// 释放锁的超时时间, 不受调用方 ctx 的影响
+const releaseTimeout = 5 * time.Second
+
+var ErrSessionMismatch = errors.New("the transaction session does not hold the lock")
+
+// Fencing 事务持有锁期间的栅栏信息
+// Version 在每次提交的加锁事务中单调递增, 可写入业务数据用于拒绝过期持有者的写入
+type Fencing struct {
+	Name         string
+	ConnectionID int64
+	Version      int64
+}
+
+var fencings sync.Map // *sql.Tx -> *Fencing
+
+// FencingFromTx 在 WithLockTx 的回调中获取当前事务的栅栏信息
+func FencingFromTx(tx *sql.Tx) (*Fencing, bool) {
+	f, ok := fencings.Load(tx)
+	if !ok {
+		return nil, false
+	}
+	return f.(*Fencing), true
+}
+
+// WithLockTx 在持有 GET_LOCK 的同一个会话上执行事务
+// fn 返回 nil 时提交, 否则回滚, 事务结束后释放锁
+// 连接池只有一个连接且已被事务占用, fn 中只能通过 tx 执行语句, 在同一个 *sql.DB 上查询会死锁
+func WithLockTx(ctx context.Context, name string, fn func(*sql.Tx) error, opts ...rwlock.Option) (err error) {
+	ops := &rwlock.Options{}
+	for _, o := range opts {
+		o(ops)
+	}
+	mutex := dlock.allocation(name, ops)
+	rw, ok := mutex.(*rwMysql)
+	if !ok {
+		// 名称不合法, 返回其错误
+		return mutex.Lock(ctx)
+	}
+	if err = rw.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		// ctx 已结束时仍需发送 RELEASE_LOCK, 否则会话会一直持有锁
+		uctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		defer cancel()
+		if uerr := rw.Unlock(uctx); err == nil {
+			err = uerr
+		}
+	}()
+
+	// Init 将连接池限制为一个连接, 取到的连接即持有锁的会话, 这里再做一次校验
+	conn, err := rw.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fencing := &Fencing{Name: name}
+	var held sql.NullBool
+	err = conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID(), CONNECTION_ID()",
+		rw.name.Key).Scan(&held, &fencing.ConnectionID)
+	if err != nil {
+		return err
+	} else if !held.Bool {
+		return fmt.Errorf("%w: %s", ErrSessionMismatch, rw.name)
+	}
+	if err = ensureTable(ctx, rw.db, conn, fencingTable); err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if fencing.Version, err = nextVersion(ctx, tx, rw.name.Key); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	fencings.Store(tx, fencing)
+	defer fencings.Delete(tx)
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func nextVersion(ctx context.Context, tx *sql.Tx, name string) (int64, error) {
+	_, err := tx.ExecContext(ctx, "INSERT INTO rwlock_fencing (name, version) VALUES (?, 1) "+
+		"ON DUPLICATE KEY UPDATE version = version + 1", name)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	err = tx.QueryRowContext(ctx, "SELECT version FROM rwlock_fencing WHERE name = ?", name).Scan(&version)
+	return version, err
+}
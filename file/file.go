@@ -3,52 +3,318 @@ package file
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/J-guanghua/rwlock"
 )
 
+// 设置 WithTries 时两次尝试之间的间隔
+const retryInterval = 100 * time.Millisecond
+
+var ErrExpired = errors.New("file lock expired")
+
 type rwFile struct {
+	name rwlock.Name
+	path string
+	opts *rwlock.Options
+	// 句柄按需打开, 空闲时由 janitor 关闭, 只有占用 sema 的协程可以访问
 	file *os.File
-	name string
-	m    sync.Mutex
+	// 进程内的等待队列, 持有者占用唯一的位置
+	sema chan struct{}
+	// 正在加锁或持有锁的数量, 大于 0 时不会被驱逐
+	refs int32
+	// 最后一次使用的时间, UnixNano
+	used   int64
+	locker *rwLock
+	// 当前持有者, 加锁成功后写入锁文件, 超时自动释放与 Unlock 通过 mtx 竞争
+	mtx    sync.Mutex
+	holder *Holder
+	stop   chan struct{}
+}
+
+func (file *rwFile) getOptions(ctx context.Context) *rwlock.Options {
+	if opts, ok := rwlock.FromContext(ctx); ok {
+		return opts
+	}
+	return file.opts
 }
 
-func (file *rwFile) Lock(ctx context.Context) (err error) {
-	err = file.acquireLock(ctx)
-	if !errors.Is(err, rwlock.ErrFailed) {
+func (file *rwFile) Lock(ctx context.Context) error {
+	options := file.getOptions(ctx)
+	atomic.AddInt32(&file.refs, 1)
+	if err := file.lock(ctx, options); err != nil {
+		file.release()
 		return err
-	} else if err != nil {
-	LoopLock:
+	}
+
+	// 持有者信息仅用于诊断, 写入失败不影响加锁
+	holder := newHolder(options.Value)
+	_ = writeHolder(file.file, holder)
+	file.mtx.Lock()
+	defer file.mtx.Unlock()
+	file.holder = holder
+	if options.Expiry > 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		file.stop = make(chan struct{})
+		go file.expire(&rwlock.Renewal{Ctx: ctx, Cancel: cancel, Name: file.name.Original, Value: options.Value},
+			options, holder, file.stop)
+	}
+	return nil
+}
+
+func (file *rwFile) Unlock(_ context.Context) error {
+	file.mtx.Lock()
+	defer file.mtx.Unlock()
+	if file.holder == nil {
+		return rwlock.ErrNotLocked
+	}
+	if file.stop != nil {
+		close(file.stop)
+		file.stop = nil
+	}
+	return file.unlock()
+}
+
+// 超过 Expiry 仍未释放时自动释放, 并通过 OnRenewal 通知持有者
+func (file *rwFile) expire(renewal *rwlock.Renewal, opts *rwlock.Options, holder *Holder, stop <-chan struct{}) {
+	defer renewal.Cancel()
+	timer := time.NewTimer(opts.Expiry)
+	defer timer.Stop()
+	select {
+	case <-stop:
+		return
+	case <-timer.C:
+	}
+	file.mtx.Lock()
+	if file.holder != holder {
+		file.mtx.Unlock()
+		return
+	}
+	file.stop = nil
+	renewal.Err = file.unlock()
+	file.mtx.Unlock()
+	if renewal.Err == nil {
+		renewal.Err = ErrExpired
+	}
+	if opts.OnRenewal != nil {
+		opts.OnRenewal(renewal)
+	}
+}
+
+// 调用方需持有 mtx
+func (file *rwFile) unlock() error {
+	file.holder = nil
+	_ = clearHolder(file.file)
+	err := unlock(file.file)
+	if file.locker.isClosed() {
+		file.close()
+	}
+	<-file.sema
+	file.release()
+	return err
+}
+
+func (file *rwFile) lock(ctx context.Context, options *rwlock.Options) error {
+	if err := file.enqueue(ctx, options.Tries); err != nil {
+		return err
+	}
+	for {
+		if err := file.open(); err != nil {
+			<-file.sema
+			return err
+		}
+		err := tryLock(file.file, true)
+		if errors.Is(err, rwlock.ErrFailed) {
+			file.checkStale()
+			if options.Tries > 0 {
+				err = file.retry(ctx, options.Tries)
+			} else {
+				err = file.wait(ctx)
+			}
+		} else if err != nil {
+			<-file.sema
+		}
+		if err != nil {
+			return err
+		}
+
+		// 锁文件可能在等待期间被其他进程删除, 此时持有的是已失效的文件, 需要重新打开
+		if current, err := file.current(); err != nil {
+			_ = unlock(file.file)
+			<-file.sema
+			return err
+		} else if current {
+			return nil
+		}
+		_ = unlock(file.file)
+		file.close()
+	}
+}
+
+// 进入进程内的等待队列, 限制尝试次数时进程内的竞争同样计入
+func (file *rwFile) enqueue(ctx context.Context, tries int) error {
+	if tries <= 0 {
 		select {
+		case file.sema <- struct{}{}:
+			return nil
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(1000 * time.Millisecond):
-			err := file.acquireLock(ctx)
-			if errors.Is(err, rwlock.ErrFailed) {
-				goto LoopLock
-			} else if err != nil {
-				return err
+		}
+	}
+	for i := 1; ; i++ {
+		select {
+		case file.sema <- struct{}{}:
+			return nil
+		default:
+		}
+		if i >= tries {
+			return fmt.Errorf("尝试 %d 次,获取锁失败: %w", i, rwlock.ErrFailed)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// 其他进程持有锁, 在单独的协程中阻塞等待, 持有者释放后内核立即唤醒
+// 返回错误时已让出等待队列
+func (file *rwFile) wait(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func(f *os.File) {
+		done <- waitLock(f, true)
+	}(file.file)
+	select {
+	case err := <-done:
+		if err != nil {
+			<-file.sema
+		}
+		return err
+	case <-ctx.Done():
+		go file.abandon(file.file, done)
+		return ctx.Err()
+	}
+}
+
+// 限制尝试次数时轮询加锁, 返回错误时已让出等待队列
+func (file *rwFile) retry(ctx context.Context, tries int) error {
+	for i := 1; ; i++ {
+		if i >= tries {
+			<-file.sema
+			return fmt.Errorf("尝试 %d 次,获取锁失败: %w", i, rwlock.ErrFailed)
+		}
+		select {
+		case <-ctx.Done():
+			<-file.sema
+			return ctx.Err()
+		case <-time.After(retryInterval):
+		}
+		if err := tryLock(file.file, true); !errors.Is(err, rwlock.ErrFailed) {
+			if err != nil {
+				<-file.sema
 			}
+			return err
 		}
 	}
+}
+
+// 等待已取消, 阻塞的加锁无法中断, 拿到锁后立即释放并让出等待队列
+func (file *rwFile) abandon(f *os.File, done <-chan error) {
+	if err := <-done; err == nil {
+		_ = unlock(f)
+	}
+	if file.locker.isClosed() {
+		file.close()
+	}
+	<-file.sema
+}
+
+// 锁被占用时检查持有者进程是否还存活
+func (file *rwFile) checkStale() {
+	if file.locker.onStale == nil {
+		return
+	}
+	if holder, err := readHolder(file.file); err == nil && holder != nil && holder.Stale() {
+		file.locker.onStale(file.name, holder)
+	}
+}
+
+func (file *rwFile) open() error {
+	if file.locker.isClosed() {
+		return ErrClosed
+	} else if file.file != nil {
+		return nil
+	}
+	f, err := os.OpenFile(file.path, os.O_CREATE|os.O_RDWR, fs.FileMode(0o666))
+	if err != nil {
+		return err
+	}
+	file.file = f
+	file.locker.register(file)
 	return nil
 }
 
-func (file *rwFile) Unlock(ctx context.Context) error {
-	return file.releaseLock(ctx)
+func (file *rwFile) close() {
+	if file.file != nil {
+		_ = file.file.Close()
+		file.file = nil
+	}
 }
 
-// 获取文件句柄
-func (file *rwFile) acquireLock(_ context.Context) error {
-	file.m.Lock()
-	return acquireLock(file.file)
+// 句柄是否仍指向路径上的锁文件
+func (file *rwFile) current() (bool, error) {
+	return sameFile(file.file, file.path)
 }
 
-// 释放文件锁
-func (file *rwFile) releaseLock(_ context.Context) error {
-	defer file.m.Unlock()
-	return releaseLock(file.file)
+// 文件可能在等待锁期间被删除或替换, 此时持有的是已失效的文件
+func sameFile(f *os.File, path string) (bool, error) {
+	opened, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return os.SameFile(opened, stat), nil
+}
+
+func (file *rwFile) release() {
+	atomic.StoreInt64(&file.used, time.Now().UnixNano())
+	atomic.AddInt32(&file.refs, -1)
+}
+
+func (file *rwFile) idle(timeout time.Duration) bool {
+	used := time.Unix(0, atomic.LoadInt64(&file.used))
+	return atomic.LoadInt32(&file.refs) == 0 && time.Since(used) >= timeout
+}
+
+// 关闭空闲句柄, remove 为 true 时持有文件锁删除锁文件
+// 其他进程在删除前打开的旧文件会在加锁后的校验中被发现并重新打开
+func (file *rwFile) evict(timeout time.Duration, remove bool) {
+	select {
+	case file.sema <- struct{}{}:
+	default:
+		return
+	}
+	defer func() { <-file.sema }()
+	if !file.idle(timeout) {
+		return
+	}
+	if remove && file.file != nil && tryLock(file.file, true) == nil {
+		if current, _ := file.current(); current {
+			_ = os.Remove(file.path)
+		}
+		_ = unlock(file.file)
+	}
+	file.close()
+	file.locker.unregister(file)
 }
@@ -1,28 +1,73 @@
 package file
 
 import (
-	"fmt"
+	"errors"
 	"os"
 	"syscall"
 
 	"github.com/J-guanghua/rwlock"
 )
 
-func acquireLock(file *os.File) error {
-	// 尝试获取文件锁
-	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
-	if err != nil {
-		fmt.Println("Failed to acquire lock:", err)
+// 非阻塞获取文件锁, 已被占用时返回 rwlock.ErrFailed
+func tryLock(file *os.File, exclusive bool) error {
+	err := flockRetry(file, lockHow(exclusive)|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
 		return rwlock.ErrFailed
 	}
-	return nil
+	return err
 }
 
-func releaseLock(file *os.File) error {
-	// 释放文件锁
-	err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
-	if err != nil {
-		fmt.Println("Failed to acquire lock:", err)
+// 阻塞直到获取文件锁
+func waitLock(file *os.File, exclusive bool) error {
+	return flockRetry(file, lockHow(exclusive))
+}
+
+// 释放文件锁
+func unlock(file *os.File) error {
+	return flockRetry(file, syscall.LOCK_UN)
+}
+
+func lockHow(exclusive bool) int {
+	if exclusive {
+		return syscall.LOCK_EX
+	}
+	return syscall.LOCK_SH
+}
+
+func flockRetry(file *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+// 进程是否存在, 没有权限发送信号时也视为存在
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// 文件沿用 owner 的属主和属组, 无权修改属主时保留当前用户
+func chown(f *os.File, owner os.FileInfo) error {
+	stat, ok := owner.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	err := f.Chown(int(stat.Uid), int(stat.Gid))
+	if errors.Is(err, syscall.EPERM) {
+		return nil
 	}
 	return err
 }
+
+// 同步目录, 保证改名操作落盘
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -1,43 +1,71 @@
 package file
 
 import (
+	"errors"
 	"os"
 
+	"github.com/J-guanghua/rwlock"
 	"golang.org/x/sys/windows"
 )
 
-func acquireLock(file *os.File) error {
-	handle := file.Fd()
-	// 获取锁定文件的大小
-	var fileSize int64
-	fileStat, err := file.Stat()
-	if err != nil {
-		return err
+// 锁定文件末尾之外的一个字节, 不影响其他进程读取文件内容
+const lockOffsetHigh = 0x7fffffff
+
+// GetExitCodeProcess 对仍在运行的进程返回 STILL_ACTIVE
+const stillActive = 259
+
+// 非阻塞获取文件锁, 已被占用时返回 rwlock.ErrFailed
+func tryLock(file *os.File, exclusive bool) error {
+	err := lockFileEx(file, lockFlags(exclusive)|windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) || errors.Is(err, windows.ERROR_IO_PENDING) {
+		return rwlock.ErrFailed
 	}
-	fileSize = fileStat.Size()
-	// 锁定整个文件
-	overlapped := &windows.Overlapped{}
-	err = windows.LockFileEx(windows.Handle(handle), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 0, uint32(fileSize), overlapped)
-	if err != nil {
-		return err
+	return err
+}
+
+// 阻塞直到获取文件锁
+func waitLock(file *os.File, exclusive bool) error {
+	return lockFileEx(file, lockFlags(exclusive))
+}
+
+// 释放文件锁
+func unlock(file *os.File) error {
+	overlapped := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, overlapped)
+}
+
+func lockFlags(exclusive bool) uint32 {
+	if exclusive {
+		return windows.LOCKFILE_EXCLUSIVE_LOCK
 	}
-	return nil
+	return 0
+}
+
+func lockFileEx(file *os.File, flags uint32) error {
+	overlapped := &windows.Overlapped{OffsetHigh: lockOffsetHigh}
+	return windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, overlapped)
 }
 
-func releaseLock(file *os.File) error {
-	handle := file.Fd()
-	// 获取锁定文件的大小
-	var fileSize int64
-	fileStat, err := file.Stat()
+// 进程是否仍在运行
+func processAlive(pid int) bool {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
 	if err != nil {
-		return err
+		return errors.Is(err, windows.ERROR_ACCESS_DENIED)
 	}
-	fileSize = fileStat.Size()
-	// 解锁整个文件
-	overlapped := &windows.Overlapped{}
-	err = windows.UnlockFileEx(windows.Handle(handle), 0, 0, uint32(fileSize), overlapped)
-	if err != nil {
-		return err
+	defer windows.CloseHandle(handle) // nolint
+	var code uint32
+	if err = windows.GetExitCodeProcess(handle, &code); err != nil {
+		return true
 	}
+	return code == stillActive
+}
+
+// windows 的文件权限由 ACL 继承, 不需要修改属主
+func chown(_ *os.File, _ os.FileInfo) error {
+	return nil
+}
+
+// windows 无法打开目录执行 fsync, 改名由文件系统日志保证
+func syncDir(_ string) error {
 	return nil
 }
@@ -0,0 +1,115 @@
+package file
+
+import (
+	"context"
+	"sync"
+
+	"github.com/J-guanghua/rwlock"
+)
+
+// 进程内的读写状态, 系统锁属于打开的文件描述, 同一个描述上的互斥需要自己保证
+// 第一个读者和写者负责获取系统锁, 期间 busy 为 true, 其他加锁者等待
+type gate struct {
+	mtx sync.Mutex
+	// 所属 map 中的引用数, 由持有 map 的一方维护
+	refs    int
+	readers int
+	writer  bool
+	// 正在获取系统锁
+	busy bool
+	// 等待中的写锁, 大于 0 时新的读锁需要等待
+	pending int
+	changed chan struct{}
+}
+
+func newGate() *gate {
+	return &gate{changed: make(chan struct{})}
+}
+
+// 进程内加锁, shared 为 true 表示系统读锁已由其他读者持有, 不需要再获取
+func (g *gate) acquire(ctx context.Context, exclusive bool) (shared bool, err error) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	for g.blocked(exclusive) {
+		if exclusive {
+			g.pending++
+		}
+		changed := g.changed
+		g.mtx.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+		g.mtx.Lock()
+		if exclusive {
+			g.pending--
+		}
+		if ctx.Err() != nil {
+			// 放弃的写锁可能阻塞着读锁
+			g.broadcast()
+			return false, ctx.Err()
+		}
+	}
+	return g.take(exclusive), nil
+}
+
+// 不等待的进程内加锁, 需要等待时返回 rwlock.ErrFailed
+func (g *gate) tryAcquire(exclusive bool) (shared bool, err error) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.blocked(exclusive) {
+		return false, rwlock.ErrFailed
+	}
+	return g.take(exclusive), nil
+}
+
+// 调用方需持有 mtx
+func (g *gate) blocked(exclusive bool) bool {
+	return g.writer || g.busy || (exclusive && g.readers > 0) || (!exclusive && g.pending > 0)
+}
+
+// 调用方需持有 mtx, 返回 true 表示加入已持有的系统读锁
+func (g *gate) take(exclusive bool) bool {
+	if !exclusive && g.readers > 0 {
+		g.readers++
+		return true
+	}
+	g.busy = true
+	return false
+}
+
+func (g *gate) acquired(ok, exclusive bool) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.busy = false
+	if ok && exclusive {
+		g.writer = true
+	} else if ok {
+		g.readers = 1
+	}
+	g.broadcast()
+}
+
+// 释放进程内的锁, 需要释放系统锁时调用 unlock
+func (g *gate) release(exclusive bool, unlock func() error) error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if (exclusive && !g.writer) || (!exclusive && g.readers == 0) {
+		return rwlock.ErrNotLocked
+	}
+	var err error
+	if exclusive {
+		g.writer = false
+		err = unlock()
+	} else if g.readers--; g.readers == 0 {
+		err = unlock()
+	}
+	g.broadcast()
+	return err
+}
+
+// 唤醒所有等待者重新检查状态
+func (g *gate) broadcast() {
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
@@ -0,0 +1,98 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/J-guanghua/rwlock"
+	"github.com/google/uuid"
+)
+
+var (
+	hostname, _ = os.Hostname()
+	startTime   = time.Now()
+)
+
+// 持有者信息的最大长度
+const maxHolderSize = 4096
+
+// Holder 写入锁文件的持有者信息
+type Holder struct {
+	Pid        int       `json:"pid"`
+	Hostname   string    `json:"hostname"`
+	StartTime  time.Time `json:"start_time"`
+	Token      string    `json:"token"`
+	Value      string    `json:"value,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+func newHolder(value string) *Holder {
+	return &Holder{
+		Pid:        os.Getpid(),
+		Hostname:   hostname,
+		StartTime:  startTime,
+		Token:      uuid.NewString(),
+		Value:      value,
+		AcquiredAt: time.Now(),
+	}
+}
+
+// Local 持有者是否在当前主机上
+func (h *Holder) Local() bool {
+	return h.Hostname == hostname
+}
+
+// Stale 持有者在当前主机上且进程已经退出
+func (h *Holder) Stale() bool {
+	return h.Local() && !processAlive(h.Pid)
+}
+
+// ReadHolder 读取锁文件中记录的持有者, 锁未被持有时返回 nil
+func ReadHolder(name string, opts ...rwlock.Option) (*Holder, error) {
+	path, err := Path(name, ".txt", opts...)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// 持有者崩溃后锁文件中仍留有其信息, 能加共享锁说明锁未被持有
+	if err = tryLock(f, false); err == nil {
+		return nil, unlock(f)
+	} else if !errors.Is(err, rwlock.ErrFailed) {
+		return nil, err
+	}
+	return readHolder(f)
+}
+
+func readHolder(f *os.File) (*Holder, error) {
+	holder := &Holder{}
+	// 写入时先覆盖再截断, 只解析第一个对象
+	err := json.NewDecoder(io.NewSectionReader(f, 0, maxHolderSize)).Decode(holder)
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	return holder, err
+}
+
+func writeHolder(f *os.File, holder *Holder) error {
+	b, err := json.Marshal(holder)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteAt(b, 0); err != nil {
+		return err
+	}
+	return f.Truncate(int64(len(b)))
+}
+
+func clearHolder(f *os.File) error {
+	return f.Truncate(0)
+}
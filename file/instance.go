@@ -0,0 +1,128 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/J-guanghua/rwlock"
+)
+
+var ErrAlreadyRunning = errors.New("another instance is running")
+
+// RunningError 锁已被其他实例持有, Holder 为锁文件中记录的持有者, 读取失败时为 nil
+type RunningError struct {
+	Name   string
+	Holder *Holder
+}
+
+func (e *RunningError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%s: %v", e.Name, ErrAlreadyRunning)
+	}
+	return fmt.Sprintf("%s: %v, pid %d on %s", e.Name, ErrAlreadyRunning, e.Holder.Pid, e.Holder.Hostname)
+}
+
+func (e *RunningError) Unwrap() error {
+	return ErrAlreadyRunning
+}
+
+type instanceOptions struct {
+	wait    bool
+	signal  os.Signal
+	pidFile string
+}
+
+type InstanceOption func(o *instanceOptions)
+
+// 已有实例运行时等待其退出后接管, 而不是立即返回 RunningError
+func WithWait() InstanceOption {
+	return func(o *instanceOptions) {
+		o.wait = true
+	}
+}
+
+// 已有实例运行在本机时向其发送 sig, 然后等待其退出后接管
+func WithSignal(sig os.Signal) InstanceOption {
+	return func(o *instanceOptions) {
+		o.signal = sig
+		o.wait = true
+	}
+}
+
+// 获取锁后将 pid 写入 path, 供不读取锁文件的运维工具使用, 释放时删除
+func WithPidFile(path string) InstanceOption {
+	return func(o *instanceOptions) {
+		o.pidFile = path
+	}
+}
+
+// Instance 进程内唯一的实例, 在进程退出或 Release 前一直持有锁
+type Instance struct {
+	name    string
+	mutex   rwlock.Mutex
+	pidFile string
+}
+
+// SingleInstance 保证同名的实例在本机只运行一个, 锁文件中记录当前实例的 pid 等信息
+// 已有实例运行时返回 *RunningError, 可以通过 errors.Is(err, ErrAlreadyRunning) 判断
+func SingleInstance(ctx context.Context, name string, opts ...InstanceOption) (*Instance, error) {
+	o := &instanceOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	instance := &Instance{name: name, mutex: Mutex(name, rwlock.WithValue(strconv.Itoa(os.Getpid())))}
+	try := ctx
+	if file, ok := instance.mutex.(*rwFile); ok {
+		// 复制锁的选项只修改尝试次数, 保留写入持有者信息的 pid
+		opts := *file.opts
+		opts.Tries = 1
+		try = rwlock.WithContext(ctx, &opts)
+	}
+	err := instance.mutex.Lock(try)
+	if errors.Is(err, rwlock.ErrFailed) {
+		holder, _ := ReadHolder(name)
+		if !o.wait {
+			return nil, &RunningError{Name: name, Holder: holder}
+		}
+		if o.signal != nil && holder != nil && holder.Local() {
+			// 持有者可能恰好已经退出
+			if err = signalProcess(holder.Pid, o.signal); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				return nil, err
+			}
+		}
+		err = instance.mutex.Lock(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if o.pidFile != "" {
+		pid := []byte(strconv.Itoa(os.Getpid()) + "\n")
+		if err = writeFile(ctx, ctx, o.pidFile, pid, 0o644, nil); err != nil {
+			_ = instance.mutex.Unlock(ctx)
+			return nil, err
+		}
+		instance.pidFile = o.pidFile
+	}
+	return instance, nil
+}
+
+// Release 删除 pid 文件并释放锁, 进程退出时系统也会自动释放锁
+func (i *Instance) Release() error {
+	if i.pidFile != "" {
+		_ = os.Remove(i.pidFile)
+		i.pidFile = ""
+	}
+	return i.mutex.Unlock(context.TODO())
+}
+
+func signalProcess(pid int, sig os.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
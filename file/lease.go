@@ -0,0 +1,321 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/J-guanghua/rwlock"
+	"github.com/google/uuid"
+)
+
+// 获取租约失败后重试的间隔
+const leaseRetry = 100 * time.Millisecond
+
+// 接管标记存在超过该时长时视为接管者已崩溃, 删除后重新接管
+const stealTimeout = 10 * time.Second
+
+// 租约文件的内容
+type lease struct {
+	Holder
+	Expires time.Time `json:"expires"`
+}
+
+func (l *lease) expired() bool {
+	return time.Now().After(l.Expires)
+}
+
+// 不依赖 flock 的租约锁, 通过 link 原子地创建锁文件, 适用于 NFS 等共享目录
+// 持有期间定期续租, 租约过期后其他主机可以安全地接管, 各主机的时钟需要同步
+type rwLease struct {
+	name   rwlock.Name
+	path   string
+	opts   *rwlock.Options
+	sema   chan struct{}
+	holder *Holder
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (rw *rwLock) leaseAllocation(name string, opts *rwlock.Options) rwlock.Mutex {
+	n, err := namePolicy.Normalize(opts.Namespace, name)
+	if err != nil {
+		return rwlock.InvalidMutex(err)
+	}
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	if rw.leases[n.Key] == nil {
+		rw.leases[n.Key] = &rwLease{
+			name: n,
+			path: filepath.Join(rw.directory, n.Key+".lease"),
+			opts: opts,
+			sema: make(chan struct{}, 1),
+		}
+	}
+	return rw.leases[n.Key]
+}
+
+// LeaseMutex 基于租约文件的锁, Expiry 为租约时长, 默认 6 秒
+func LeaseMutex(name string, opts ...rwlock.Option) rwlock.Mutex {
+	opt := &rwlock.Options{
+		Expiry:    6 * time.Second,
+		Value:     "default",
+		OnRenewal: func(r *rwlock.Renewal) {},
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	return flock.leaseAllocation(name, opt)
+}
+
+func (l *rwLease) getOptions(ctx context.Context) *rwlock.Options {
+	if opts, ok := rwlock.FromContext(ctx); ok {
+		return opts
+	}
+	return l.opts
+}
+
+func (l *rwLease) Lock(ctx context.Context) error {
+	select {
+	case l.sema <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	options := l.getOptions(ctx)
+	var tries int
+	for {
+		tries++
+		err := l.acquireLock(ctx, options)
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, rwlock.ErrFailed) {
+			<-l.sema
+			return err
+		} else if options.Tries > 0 && tries >= options.Tries {
+			<-l.sema
+			return fmt.Errorf("尝试 %d 次,获取锁失败: %w", tries, rwlock.ErrFailed)
+		}
+		select {
+		case <-ctx.Done():
+			<-l.sema
+			return ctx.Err()
+		case <-time.After(leaseRetry):
+		}
+	}
+}
+
+func (l *rwLease) Unlock(_ context.Context) error {
+	if len(l.sema) == 0 {
+		return rwlock.ErrNotLocked
+	}
+	defer func() { <-l.sema }()
+	// 等待续租协程退出, 避免释放后又被续租写回
+	l.cancel()
+	<-l.done
+	// 与接管者使用同一个标记, 释放期间租约不会被接管
+	release, err := markSteal(l.path, l.holder.Token)
+	if errors.Is(err, rwlock.ErrFailed) {
+		// 租约已过期, 正在被其他主机接管
+		return rwlock.ErrNotLocked
+	} else if err != nil {
+		return err
+	}
+	defer release()
+	current, err := readLease(l.path)
+	if err != nil {
+		return err
+	} else if current == nil || current.Token != l.holder.Token {
+		return rwlock.ErrNotLocked
+	}
+	aside, moved, err := moveAside(l.path)
+	if aside == "" {
+		if err == nil {
+			err = rwlock.ErrNotLocked
+		}
+		return err
+	} else if err != nil || moved == nil || moved.Token != l.holder.Token {
+		_ = restore(aside, l.path)
+		if err == nil {
+			err = rwlock.ErrNotLocked
+		}
+		return err
+	}
+	return os.Remove(aside)
+}
+
+// 通过 link 原子地创建租约文件, 已存在且过期时先接管再重试一次
+func (l *rwLease) acquireLock(ctx context.Context, opts *rwlock.Options) error {
+	holder := newHolder(opts.Value)
+	for i := 0; i < 2; i++ {
+		tmp, err := writeLease(l.path, holder, opts)
+		if err != nil {
+			return err
+		}
+		// NFS 上 link 成功也可能因为重传返回错误, 以文件内容判断是否获取成功
+		_ = os.Link(tmp, l.path)
+		_ = os.Remove(tmp)
+		current, err := readLease(l.path)
+		if err != nil {
+			return err
+		} else if current != nil && current.Token == holder.Token {
+			l.holder = holder
+			l.done = make(chan struct{})
+			ctx, l.cancel = context.WithCancel(ctx)
+			go l.touchRenewal(&rwlock.Renewal{Ctx: ctx, Name: l.name.Original, Value: opts.Value, Cancel: l.cancel}, holder)
+			return nil
+		} else if current == nil || !current.expired() {
+			return rwlock.ErrFailed
+		}
+		if err = steal(l.path, current); err != nil {
+			return err
+		}
+	}
+	return rwlock.ErrFailed
+}
+
+// 过期前续租, 通过改名原子地替换租约文件
+func (l *rwLease) touchRenewal(renewal *rwlock.Renewal, holder *Holder) {
+	defer close(l.done)
+	opts := l.getOptions(renewal.Ctx)
+	for {
+		select {
+		case <-renewal.Ctx.Done():
+			return
+		case <-time.After(opts.Expiry / 3):
+			renewal.Result, renewal.Err = renewLease(l.path, holder, opts)
+			if renewal.Ctx.Err() != nil {
+				return
+			}
+			if opts.OnRenewal != nil {
+				opts.OnRenewal(renewal)
+			}
+			if !renewal.Result {
+				renewal.Cancel()
+				return
+			}
+		}
+	}
+}
+
+// 与接管者使用同一个标记, 确认与改名之间租约不会被接管, 标记已存在说明租约正在被接管
+func renewLease(path string, holder *Holder, opts *rwlock.Options) (bool, error) {
+	tmp, err := writeLease(path, holder, opts)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp) // nolint
+	release, err := markSteal(path, holder.Token)
+	if errors.Is(err, rwlock.ErrFailed) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer release()
+	current, err := readLease(path)
+	// 已过期的租约可能已被接管, 不再续租
+	if err != nil || current == nil || current.Token != holder.Token || current.expired() {
+		return false, err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 接管过期的租约
+// 持有该租约的接管标记后重新读取, 确认仍是看到的过期租约才删除, 不会移动未过期的租约
+func steal(path string, expired *lease) error {
+	release, err := markSteal(path, expired.Token)
+	if err != nil {
+		return err
+	}
+	defer release()
+	current, err := readLease(path)
+	if err != nil || current == nil || current.Token != expired.Token || !current.expired() {
+		return err
+	}
+	if err = os.Remove(path); os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// 以 O_EXCL 创建租约的接管标记, 同一租约同时只有一个主机接管或释放
+// 标记已存在时返回 rwlock.ErrFailed, 由调用者稍后重试
+func markSteal(path, token string) (func(), error) {
+	marker := path + "." + token + ".steal"
+	f, err := os.OpenFile(marker, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666)
+	if os.IsExist(err) {
+		if info, serr := os.Stat(marker); serr == nil && time.Since(info.ModTime()) > stealTimeout {
+			_ = os.Remove(marker)
+		}
+		return nil, rwlock.ErrFailed
+	} else if err != nil {
+		return nil, err
+	}
+	_ = f.Close()
+	return func() { _ = os.Remove(marker) }, nil
+}
+
+// 将租约文件改名移走并读取内容, 文件不存在时返回空路径
+func moveAside(path string) (string, *lease, error) {
+	aside := path + "." + uuid.NewString() + ".aside"
+	if err := os.Rename(path, aside); os.IsNotExist(err) {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	moved, err := readLease(aside)
+	return aside, moved, err
+}
+
+// 放回误移走的租约, 原位置已被他人获取时保留他人的租约
+func restore(aside, path string) error {
+	defer os.Remove(aside) // nolint
+	if err := os.Link(aside, path); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// 写入临时文件, 返回临时文件路径
+func writeLease(path string, holder *Holder, opts *rwlock.Options) (string, error) {
+	b, err := json.Marshal(&lease{
+		Holder:  *holder,
+		Expires: time.Now().Add(opts.Expiry),
+	})
+	if err != nil {
+		return "", err
+	}
+	tmp := path + "." + uuid.NewString() + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666)
+	if err != nil {
+		return "", err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+func readLease(path string) (*lease, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	l := &lease{}
+	return l, json.Unmarshal(b, l)
+}
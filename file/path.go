@@ -0,0 +1,157 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/J-guanghua/rwlock"
+)
+
+// 锁定任意已有路径, 与 flock(1) 等对同一文件加锁的进程互斥
+// 不会向文件写入任何内容
+type rwPath struct {
+	path string
+	// 只有正在获取系统锁或最后一个释放的协程可以访问
+	file *os.File
+	gate *gate
+}
+
+// 同一路径的各次调用共享 rwPath, 创建权限只作用于本次返回的锁
+type pathMutex struct {
+	*rwPath
+	// 文件不存在时以该权限创建, 为 0 时不创建
+	perm os.FileMode
+}
+
+type pathOptions struct {
+	perm os.FileMode
+}
+
+type PathOption func(o *pathOptions)
+
+// 路径不存在时以 perm 权限创建文件
+func WithCreate(perm os.FileMode) PathOption {
+	return func(o *pathOptions) {
+		o.perm = perm
+	}
+}
+
+func (rw *rwLock) pathAllocation(path string, opts []PathOption) rwlock.RWMutex {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	if rw.paths[path] == nil {
+		rw.paths[path] = &rwPath{path: path, gate: newGate()}
+	}
+	o := &pathOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return pathMutex{rwPath: rw.paths[path], perm: o.perm}
+}
+
+// PathMutex 对给定路径的文件加排他锁, 同一路径在进程内共享同一个锁
+func PathMutex(path string, opts ...PathOption) rwlock.Mutex {
+	return PathRWMutex(path, opts...)
+}
+
+// PathRWMutex 对给定路径的文件加读写锁, 读锁对应 flock 的共享锁
+func PathRWMutex(path string, opts ...PathOption) rwlock.RWMutex {
+	return flock.pathAllocation(path, opts)
+}
+
+func (p pathMutex) Lock(ctx context.Context) error {
+	return p.acquire(ctx, true, p.perm)
+}
+
+func (p *rwPath) Unlock(_ context.Context) error {
+	return p.gate.release(true, p.release)
+}
+
+func (p pathMutex) RLock(ctx context.Context) error {
+	return p.acquire(ctx, false, p.perm)
+}
+
+func (p *rwPath) RUnlock(_ context.Context) error {
+	return p.gate.release(false, p.release)
+}
+
+func (p *rwPath) acquire(ctx context.Context, exclusive bool, perm os.FileMode) error {
+	shared, err := p.gate.acquire(ctx, exclusive)
+	if err != nil || shared {
+		return err
+	}
+	for {
+		if p.file == nil {
+			if p.file, err = p.open(perm); err != nil {
+				p.gate.acquired(false, exclusive)
+				return err
+			}
+		}
+		err = tryLock(p.file, exclusive)
+		if errors.Is(err, rwlock.ErrFailed) {
+			done := make(chan error, 1)
+			go func(f *os.File) {
+				done <- waitLock(f, exclusive)
+			}(p.file)
+			select {
+			case err = <-done:
+			case <-ctx.Done():
+				go p.abandon(done)
+				return ctx.Err()
+			}
+		}
+		if err != nil {
+			p.closeFile()
+			p.gate.acquired(false, exclusive)
+			return err
+		}
+
+		// 其他程序可能通过改名替换了文件, 需要锁定路径上当前的文件
+		current, err := sameFile(p.file, p.path)
+		if err == nil && current {
+			p.gate.acquired(true, exclusive)
+			return nil
+		}
+		_ = unlock(p.file)
+		p.closeFile()
+		if err != nil {
+			p.gate.acquired(false, exclusive)
+			return err
+		}
+	}
+}
+
+// 等待已取消, 拿到锁后立即释放
+func (p *rwPath) abandon(done <-chan error) {
+	if err := <-done; err == nil {
+		_ = unlock(p.file)
+	}
+	p.closeFile()
+	p.gate.acquired(false, false)
+}
+
+// 最后一个持有者释放系统锁并关闭文件, 不长期占用用户的文件
+func (p *rwPath) release() error {
+	err := unlock(p.file)
+	p.closeFile()
+	return err
+}
+
+func (p *rwPath) open(perm os.FileMode) (*os.File, error) {
+	if perm != 0 {
+		return os.OpenFile(p.path, os.O_RDONLY|os.O_CREATE, perm)
+	}
+	return os.Open(p.path)
+}
+
+func (p *rwPath) closeFile() {
+	if p.file != nil {
+		_ = p.file.Close()
+		p.file = nil
+	}
+}
@@ -0,0 +1,266 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/J-guanghua/rwlock"
+)
+
+// 偏移量的取值范围, 锁定文件末尾之外的字节不会增加文件大小
+const rangeMask = 1<<62 - 1
+
+// 一个分片文件, 通过字节范围锁承载大量锁名称
+type rangeShard struct {
+	mtx     sync.Mutex
+	path    string
+	file    *os.File
+	entries map[int64]*gate
+	closed  bool
+}
+
+type rangeLock struct {
+	name   rwlock.Name
+	opts   *rwlock.Options
+	shard  *rangeShard
+	offset int64
+}
+
+// 字节范围锁没有持有者信息和过期时间, 只支持 Namespace 和 Tries
+func checkRangeOptions(opts *rwlock.Options) error {
+	if opts.Expiry != 0 || opts.Value != "" || opts.OnRenewal != nil {
+		return fmt.Errorf("%w: range locks support only Namespace and Tries", ErrUnsupportedOption)
+	}
+	return nil
+}
+
+func newShards(directory string, size int) []*rangeShard {
+	shards := make([]*rangeShard, size)
+	for i := range shards {
+		shards[i] = &rangeShard{
+			path:    filepath.Join(directory, fmt.Sprintf("ranges-%d.lock", i)),
+			entries: make(map[int64]*gate),
+		}
+	}
+	return shards
+}
+
+func (rw *rwLock) rangeAllocation(name string, opts *rwlock.Options) rwlock.RWMutex {
+	n, err := namePolicy.Normalize(opts.Namespace, name)
+	if err != nil {
+		return rwlock.InvalidMutex(err)
+	} else if err = checkRangeOptions(opts); err != nil {
+		return rwlock.InvalidMutex(err)
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(n.Key))
+	sum := h.Sum64()
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	return &rangeLock{
+		name:   n,
+		opts:   opts,
+		shard:  rw.ranges[sum%uint64(len(rw.ranges))],
+		offset: int64(sum & rangeMask),
+	}
+}
+
+// RangeMutex 在分片锁文件中按名称哈希到的字节范围加锁, 适合数量巨大的锁名称
+func RangeMutex(name string, opts ...rwlock.Option) rwlock.Mutex {
+	return RangeRWMutex(name, opts...)
+}
+
+// RangeRWMutex 支持共享读锁的字节范围锁
+// 设置 Expiry、Value 或 OnRenewal 时加锁返回 ErrUnsupportedOption
+func RangeRWMutex(name string, opts ...rwlock.Option) rwlock.RWMutex {
+	ops := &rwlock.Options{}
+	for _, o := range opts {
+		o(ops)
+	}
+	return flock.rangeAllocation(name, ops)
+}
+
+func (r *rangeLock) Lock(ctx context.Context) error {
+	return r.acquire(ctx, true)
+}
+
+func (r *rangeLock) Unlock(_ context.Context) error {
+	return r.release(true)
+}
+
+func (r *rangeLock) RLock(ctx context.Context) error {
+	return r.acquire(ctx, false)
+}
+
+func (r *rangeLock) RUnlock(_ context.Context) error {
+	return r.release(false)
+}
+
+func (r *rangeLock) getOptions(ctx context.Context) *rwlock.Options {
+	if opts, ok := rwlock.FromContext(ctx); ok {
+		return opts
+	}
+	return r.opts
+}
+
+// 限制尝试次数时轮询加锁, 进程内的竞争同样计入
+func (r *rangeLock) acquire(ctx context.Context, exclusive bool) error {
+	opts := r.getOptions(ctx)
+	if err := checkRangeOptions(opts); err != nil {
+		return err
+	} else if opts.Tries <= 0 {
+		return r.wait(ctx, exclusive)
+	}
+	for i := 1; ; i++ {
+		err := r.try(exclusive)
+		if !errors.Is(err, rwlock.ErrFailed) {
+			return err
+		} else if i >= opts.Tries {
+			return fmt.Errorf("尝试 %d 次,获取锁失败: %w", i, rwlock.ErrFailed)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// 不等待地尝试一次, 被占用时返回 rwlock.ErrFailed
+func (r *rangeLock) try(exclusive bool) error {
+	f, entry, err := r.shard.get(r.offset)
+	if err != nil {
+		return err
+	}
+	shared, err := entry.tryAcquire(exclusive)
+	if err != nil || shared {
+		if err != nil {
+			r.shard.put(r.offset, entry)
+		}
+		return err
+	}
+	err = lockRange(f, r.offset, exclusive, false)
+	entry.acquired(err == nil, exclusive)
+	if err != nil {
+		r.shard.put(r.offset, entry)
+	}
+	return err
+}
+
+func (r *rangeLock) wait(ctx context.Context, exclusive bool) error {
+	f, entry, err := r.shard.get(r.offset)
+	if err != nil {
+		return err
+	}
+	shared, err := entry.acquire(ctx, exclusive)
+	if err != nil || shared {
+		if err != nil {
+			r.shard.put(r.offset, entry)
+		}
+		return err
+	}
+
+	// 获取系统锁, 被其他进程占用时在单独的协程中阻塞等待
+	err = lockRange(f, r.offset, exclusive, false)
+	if errors.Is(err, rwlock.ErrFailed) {
+		done := make(chan error, 1)
+		go func() {
+			done <- lockRange(f, r.offset, exclusive, true)
+		}()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			go r.abandon(f, entry, done)
+			return ctx.Err()
+		}
+	}
+	entry.acquired(err == nil, exclusive)
+	if err != nil {
+		r.shard.put(r.offset, entry)
+	}
+	return err
+}
+
+// 等待已取消, 拿到系统锁后立即释放, 期间 entry 保持占用避免进程内重复加锁
+func (r *rangeLock) abandon(f *os.File, entry *gate, done <-chan error) {
+	if err := <-done; err == nil {
+		_ = unlockRange(f, r.offset)
+	}
+	entry.acquired(false, false)
+	r.shard.put(r.offset, entry)
+}
+
+func (r *rangeLock) release(exclusive bool) error {
+	f, entry := r.shard.lookup(r.offset)
+	if entry == nil {
+		return rwlock.ErrNotLocked
+	}
+	if err := entry.release(exclusive, func() error { return unlockRange(f, r.offset) }); err != nil {
+		return err
+	}
+	r.shard.put(r.offset, entry)
+	return nil
+}
+
+func (shard *rangeShard) get(offset int64) (*os.File, *gate, error) {
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+	if shard.closed {
+		return nil, nil, ErrClosed
+	}
+	if shard.file == nil {
+		f, err := os.OpenFile(shard.path, os.O_CREATE|os.O_RDWR, fs.FileMode(0o666))
+		if err != nil {
+			return nil, nil, err
+		}
+		shard.file = f
+	}
+	entry := shard.entries[offset]
+	if entry == nil {
+		entry = newGate()
+		shard.entries[offset] = entry
+	}
+	entry.refs++
+	return shard.file, entry, nil
+}
+
+func (shard *rangeShard) lookup(offset int64) (*os.File, *gate) {
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+	return shard.file, shard.entries[offset]
+}
+
+func (shard *rangeShard) put(offset int64, entry *gate) {
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+	if entry.refs--; entry.refs == 0 {
+		delete(shard.entries, offset)
+	}
+	if shard.closed && len(shard.entries) == 0 {
+		shard.close()
+	}
+}
+
+// 关闭分片, 仍有锁被持有时在最后一次释放后关闭文件
+func (shard *rangeShard) shutdown() {
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+	shard.closed = true
+	if len(shard.entries) == 0 {
+		shard.close()
+	}
+}
+
+func (shard *rangeShard) close() {
+	if shard.file != nil {
+		_ = shard.file.Close()
+		shard.file = nil
+	}
+}
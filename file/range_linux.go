@@ -0,0 +1,40 @@
+package file
+
+import (
+	"errors"
+	"os"
+
+	"github.com/J-guanghua/rwlock"
+	"golang.org/x/sys/unix"
+)
+
+// 使用 OFD 锁锁定 offset 处的一个字节, 锁属于打开的文件描述而不是进程
+// wait 为 false 时被占用返回 rwlock.ErrFailed
+func lockRange(file *os.File, offset int64, exclusive, wait bool) error {
+	lk := &unix.Flock_t{Type: unix.F_RDLCK, Whence: 0, Start: offset, Len: 1}
+	if exclusive {
+		lk.Type = unix.F_WRLCK
+	}
+	cmd := unix.F_OFD_SETLK
+	if wait {
+		cmd = unix.F_OFD_SETLKW
+	}
+	err := fcntlFlock(file, cmd, lk)
+	if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EACCES) {
+		return rwlock.ErrFailed
+	}
+	return err
+}
+
+func unlockRange(file *os.File, offset int64) error {
+	return fcntlFlock(file, unix.F_OFD_SETLK, &unix.Flock_t{Type: unix.F_UNLCK, Whence: 0, Start: offset, Len: 1})
+}
+
+func fcntlFlock(file *os.File, cmd int, lk *unix.Flock_t) error {
+	for {
+		err := unix.FcntlFlock(file.Fd(), cmd, lk)
+		if !errors.Is(err, unix.EINTR) {
+			return err
+		}
+	}
+}
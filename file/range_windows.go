@@ -0,0 +1,34 @@
+package file
+
+import (
+	"errors"
+	"os"
+
+	"github.com/J-guanghua/rwlock"
+	"golang.org/x/sys/windows"
+)
+
+// 锁定 offset 处的一个字节, windows 的字节范围锁本身属于句柄
+// wait 为 false 时被占用返回 rwlock.ErrFailed
+func lockRange(file *os.File, offset int64, exclusive, wait bool) error {
+	var flags uint32
+	if exclusive {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	if !wait {
+		flags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+	err := windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, rangeOverlapped(offset))
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) || errors.Is(err, windows.ERROR_IO_PENDING) {
+		return rwlock.ErrFailed
+	}
+	return err
+}
+
+func unlockRange(file *os.File, offset int64) error {
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, rangeOverlapped(offset))
+}
+
+func rangeOverlapped(offset int64) *windows.Overlapped {
+	return &windows.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+}
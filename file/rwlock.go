@@ -1,57 +1,214 @@
 package file
 
 import (
-	"fmt"
-	"io/fs"
+	"errors"
 	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/J-guanghua/rwlock"
 )
 
+var (
+	ErrClosed            = errors.New("file lock closed")
+	ErrUnsupportedOption = errors.New("unsupported lock option")
+)
+
+// 文件名不能包含路径分隔符等字符, 并为 .txt 后缀预留长度
+var namePolicy = rwlock.NamePolicy{Separator: ".", MaxLength: 200, Safe: rwlock.PathSafe}
+
 type rwLock struct {
 	mtx       sync.Mutex
 	directory string
 	mutex     map[string]*rwFile
+	leases    map[string]*rwLease
+	paths     map[string]*rwPath
+	// 句柄空闲超过该时长后关闭
+	idleTimeout time.Duration
+	// 关闭空闲句柄时同时删除锁文件
+	removeIdle bool
+	// 发现持有者进程已退出时回调
+	onStale func(name rwlock.Name, holder *Holder)
+	// 字节范围锁的分片文件
+	ranges []*rangeShard
+	closed int32
+	done   chan struct{}
+}
+
+type InitOption func(rw *rwLock)
+
+// 句柄空闲多久后关闭, 默认 10 分钟
+func WithIdleTimeout(timeout time.Duration) InitOption {
+	return func(rw *rwLock) {
+		rw.idleTimeout = timeout
+	}
+}
+
+// 关闭空闲句柄时删除对应的锁文件
+func WithRemoveIdle() InitOption {
+	return func(rw *rwLock) {
+		rw.removeIdle = true
+	}
+}
+
+// 等待锁时如果发现持有者在本机且进程已经退出, 通过 f 报告
+// 常见于子进程继承了锁文件句柄
+func WithStaleHandler(f func(name rwlock.Name, holder *Holder)) InitOption {
+	return func(rw *rwLock) {
+		rw.onStale = f
+	}
 }
 
-func Init(filePath string) {
+// 字节范围锁使用的分片文件数量, 默认 16
+func WithRangeShards(n int) InitOption {
+	return func(rw *rwLock) {
+		if n > 0 {
+			rw.ranges = newShards(rw.directory, n)
+		}
+	}
+}
+
+func Init(filePath string, opts ...InitOption) {
+	_ = Close()
 	flock.mtx.Lock()
 	defer flock.mtx.Unlock()
 	if filePath == "" {
-		flock.directory = "./tmp"
+		filePath = "./tmp"
 	}
 	flock.directory = filePath
-	_, err := os.Stat(flock.directory)
-	if os.IsNotExist(err) {
-		if err = os.Mkdir(flock.directory, fs.FileMode(0o666)); err != nil {
-			panic(err)
-		}
+	if err := os.MkdirAll(flock.directory, 0o755); err != nil {
+		panic(err)
+	}
+	flock.idleTimeout = 10 * time.Minute
+	flock.removeIdle = false
+	flock.onStale = nil
+	flock.ranges = newShards(flock.directory, 16)
+	for _, o := range opts {
+		o(&flock)
 	}
 	flock.mutex = make(map[string]*rwFile)
+	flock.leases = make(map[string]*rwLease)
+	flock.paths = make(map[string]*rwPath)
+	flock.done = make(chan struct{})
+	atomic.StoreInt32(&flock.closed, 0)
+	go flock.janitor(flock.idleTimeout, flock.done)
+}
+
+// Close 关闭所有句柄, 之后的加锁返回 ErrClosed
+// 仍被持有的锁在释放时关闭句柄
+func Close() error {
+	flock.mtx.Lock()
+	defer flock.mtx.Unlock()
+	if flock.done == nil || !atomic.CompareAndSwapInt32(&flock.closed, 0, 1) {
+		return nil
+	}
+	close(flock.done)
+	for key, file := range flock.mutex {
+		select {
+		case file.sema <- struct{}{}:
+			file.close()
+			<-file.sema
+		default:
+		}
+		delete(flock.mutex, key)
+	}
+	for _, shard := range flock.ranges {
+		shard.shutdown()
+	}
+	return nil
 }
 
-func (rw *rwLock) allocation(name string) rwlock.Mutex {
+func (rw *rwLock) isClosed() bool {
+	return atomic.LoadInt32(&rw.closed) == 1
+}
+
+func (rw *rwLock) allocation(name string, opts *rwlock.Options) rwlock.Mutex {
+	n, err := namePolicy.Normalize(opts.Namespace, name)
+	if err != nil {
+		return rwlock.InvalidMutex(err)
+	}
 	rw.mtx.Lock()
 	defer rw.mtx.Unlock()
-	if rw.mutex[name] == nil {
-		filepath := fmt.Sprintf("%s/%s.txt", rw.directory, name)
-		file, err := os.OpenFile(filepath, os.O_CREATE|os.O_RDWR, fs.FileMode(0o666))
-		if err != nil {
-			panic(err)
+	if rw.mutex[n.Key] == nil {
+		rw.mutex[n.Key] = &rwFile{
+			name:   n,
+			opts:   opts,
+			path:   filepath.Join(rw.directory, n.Key+".txt"),
+			sema:   make(chan struct{}, 1),
+			locker: rw,
 		}
-		return &rwFile{
-			name: name,
-			file: file,
+	}
+	return rw.mutex[n.Key]
+}
+
+// 句柄被驱逐后再次使用时重新登记, 避免同名出现多个句柄
+func (rw *rwLock) register(file *rwFile) {
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	if rw.mutex != nil && rw.mutex[file.name.Key] == nil {
+		rw.mutex[file.name.Key] = file
+	}
+}
+
+func (rw *rwLock) unregister(file *rwFile) {
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	if rw.mutex[file.name.Key] == file {
+		delete(rw.mutex, file.name.Key)
+	}
+}
+
+// 定期关闭空闲句柄
+func (rw *rwLock) janitor(timeout time.Duration, done <-chan struct{}) {
+	if timeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			rw.mtx.Lock()
+			idle := make([]*rwFile, 0, len(rw.mutex))
+			for _, file := range rw.mutex {
+				if file.idle(timeout) {
+					idle = append(idle, file)
+				}
+			}
+			remove := rw.removeIdle
+			rw.mtx.Unlock()
+			for _, file := range idle {
+				file.evict(timeout, remove)
+			}
 		}
 	}
-	return rw.mutex[name]
 }
 
 var flock rwLock
 
-func Mutex(name string, _ ...rwlock.Option) rwlock.Mutex {
-	return flock.allocation(name)
+// Path 返回名称在锁目录下对应的文件路径, ext 为扩展名, 如 ".txt" 即 Mutex 的锁文件
+func Path(name, ext string, opts ...rwlock.Option) (string, error) {
+	ops := &rwlock.Options{}
+	for _, o := range opts {
+		o(ops)
+	}
+	n, err := namePolicy.Normalize(ops.Namespace, name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(flock.directory, n.Key+ext), nil
+}
+
+func Mutex(name string, opts ...rwlock.Option) rwlock.Mutex {
+	ops := &rwlock.Options{}
+	for _, o := range opts {
+		o(ops)
+	}
+	return flock.allocation(name, ops)
 }
 
 func RWMutex(_ string, _ ...rwlock.Option) rwlock.RWMutex { // onlit
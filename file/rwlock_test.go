@@ -2,9 +2,15 @@ package file
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -89,3 +95,647 @@ func BenchmarkRWMutex(b *testing.B) {
 		_ = mutex.Unlock(context.TODO())
 	}
 }
+
+func TestUnsafeName(t *testing.T) {
+	mutex := Mutex("../../etc/x").(*rwFile)
+	path, err := filepath.Abs(mutex.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := filepath.Abs(flock.directory)
+	if filepath.Dir(path) != dir {
+		t.Fatalf("锁文件 %s 不在目录 %s 中", path, dir)
+	}
+	if err = mutex.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	_ = mutex.Unlock(context.TODO())
+}
+
+func TestInvalidName(t *testing.T) {
+	for _, mutex := range []rwlock.Mutex{Mutex(""), LeaseMutex("a\x00b"), RangeMutex("\xff")} {
+		if err := mutex.Lock(context.TODO()); !errors.Is(err, rwlock.ErrInvalidName) {
+			t.Errorf("Lock 应返回名称错误: %v", err)
+		}
+		if err := mutex.Unlock(context.TODO()); !errors.Is(err, rwlock.ErrInvalidName) {
+			t.Errorf("Unlock 应返回名称错误: %v", err)
+		}
+	}
+}
+
+// 使用独立的 rwLock 打开锁文件, 模拟另一个进程持有的句柄
+func openFile(t *testing.T, name string) *rwFile {
+	other := &rwLock{directory: flock.directory, mutex: make(map[string]*rwFile)}
+	file := other.allocation(name, &rwlock.Options{}).(*rwFile)
+	t.Cleanup(file.close)
+	return file
+}
+
+func TestWaitWakeup(t *testing.T) {
+	holder, waiter := openFile(t, "wakeup"), openFile(t, "wakeup")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 等待取消后不能残留锁状态
+	ctx2, cancel2 := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel2()
+	if err := waiter.Lock(ctx2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望超时, 实际 %v", err)
+	}
+
+	acquired := make(chan time.Time, 1)
+	go func() {
+		if err := waiter.Lock(ctx); err != nil {
+			t.Error(err)
+		}
+		acquired <- time.Now()
+	}()
+	time.Sleep(100 * time.Millisecond)
+	released := time.Now()
+	if err := holder.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case at := <-acquired:
+		if d := at.Sub(released); d > 50*time.Millisecond {
+			t.Fatalf("释放后 %v 才唤醒", d)
+		}
+	case <-ctx.Done():
+		t.Fatal("等待者未被唤醒")
+	}
+	if err := waiter.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.Unlock(ctx); !errors.Is(err, rwlock.ErrNotLocked) {
+		t.Fatalf("重复释放应失败, 实际 %v", err)
+	}
+}
+
+func TestHandleCache(t *testing.T) {
+	if Mutex("cache") != Mutex("cache") {
+		t.Fatal("同名锁应复用句柄")
+	}
+	mutex := Mutex("cache").(*rwFile)
+	if err := mutex.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	mutex.evict(0, true)
+	if mutex.file == nil {
+		t.Fatal("持有中的句柄不能被驱逐")
+	}
+	if err := mutex.Unlock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 另一个进程打开了旧文件, 删除后加锁需要切换到新文件
+	other := openFile(t, "cache")
+	if err := other.open(); err != nil {
+		t.Fatal(err)
+	}
+	stale := other.file
+	mutex.evict(0, true)
+	if mutex.file != nil {
+		t.Fatal("空闲句柄应被关闭")
+	}
+	if _, err := os.Stat(mutex.path); !os.IsNotExist(err) {
+		t.Fatalf("锁文件应被删除: %v", err)
+	}
+	if err := other.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if other.file == stale {
+		t.Fatal("应重新打开新的锁文件")
+	}
+	if err := other.Unlock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if err := mutex.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	_ = mutex.Unlock(context.TODO())
+}
+
+func TestClose(t *testing.T) {
+	defer Init("./tmp")
+	held, idle := Mutex("close-held"), Mutex("close-idle")
+	if err := held.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := idle.Lock(context.TODO()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("关闭后加锁应失败, 实际 %v", err)
+	}
+	if err := held.Unlock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if held.(*rwFile).file != nil {
+		t.Fatal("释放后应关闭句柄")
+	}
+}
+
+func TestHolder(t *testing.T) {
+	mutex := Mutex("holder")
+	if err := mutex.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	holder, err := ReadHolder("holder")
+	if err != nil {
+		t.Fatal(err)
+	} else if holder == nil || holder.Pid != os.Getpid() || holder.Token == "" || holder.Stale() {
+		t.Fatalf("持有者信息错误: %+v", holder)
+	}
+	if err = mutex.Unlock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if holder, err = ReadHolder("holder"); err != nil || holder != nil {
+		t.Fatalf("释放后不应有持有者: %+v, %v", holder, err)
+	}
+	// 模拟崩溃的持有者留下的信息
+	path, err := Path("holder", ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(newHolder("crashed"))
+	if err = os.WriteFile(path, b, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if holder, err = ReadHolder("holder"); err != nil || holder != nil {
+		t.Fatalf("锁未被持有时不应返回残留的持有者: %+v, %v", holder, err)
+	}
+}
+
+func TestStaleHolder(t *testing.T) {
+	// 已退出进程的 pid
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip(err)
+	}
+	other := openFile(t, "stale")
+	if err := other.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Unlock(context.TODO()) // nolint
+	other.holder.Pid = cmd.Process.Pid
+	if err := writeHolder(other.file, other.holder); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := make(chan *Holder, 1)
+	flock.onStale = func(name rwlock.Name, holder *Holder) {
+		stale <- holder
+	}
+	defer func() { flock.onStale = nil }()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Mutex("stale").Lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望超时, 实际 %v", err)
+	}
+	select {
+	case holder := <-stale:
+		if holder.Pid != cmd.Process.Pid {
+			t.Fatalf("报告的持有者错误: %+v", holder)
+		}
+	default:
+		t.Fatal("未报告失效的持有者")
+	}
+}
+
+func TestTries(t *testing.T) {
+	other := openFile(t, "tries")
+	if err := other.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Unlock(context.TODO()) // nolint
+	if err := Mutex("tries", rwlock.WithTries(3)).Lock(context.TODO()); err == nil {
+		t.Fatal("锁被占用时应在尝试 3 次后失败")
+	}
+	// 通过 context 传入的选项优先
+	ctx := rwlock.WithContext(context.TODO(), &rwlock.Options{Tries: 1})
+	if err := Mutex("tries").Lock(ctx); err == nil {
+		t.Fatal("锁被占用时应失败")
+	}
+
+	// 进程内的竞争同样计入尝试次数
+	local := Mutex("tries-local")
+	if err := local.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	defer local.Unlock(context.TODO()) // nolint
+	ctx = rwlock.WithContext(context.TODO(), &rwlock.Options{Tries: 2})
+	if err := local.Lock(ctx); !errors.Is(err, rwlock.ErrFailed) {
+		t.Fatalf("期望 ErrFailed, 实际 %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	renewal := make(chan *rwlock.Renewal, 1)
+	mutex := Mutex("expiry", rwlock.WithExpiry(100*time.Millisecond), rwlock.WithValue("owner"),
+		rwlock.WithOnRenewal(func(r *rwlock.Renewal) { renewal <- r }))
+	if err := mutex.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if holder, err := ReadHolder("expiry"); err != nil || holder == nil || holder.Value != "owner" {
+		t.Fatalf("持有者信息错误: %+v, %v", holder, err)
+	}
+	select {
+	case r := <-renewal:
+		if r.Result || !errors.Is(r.Err, ErrExpired) || r.Ctx.Err() == nil {
+			t.Fatalf("超时通知错误: %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("超时后未自动释放")
+	}
+	if err := mutex.Unlock(context.TODO()); !errors.Is(err, rwlock.ErrNotLocked) {
+		t.Fatalf("自动释放后应返回 ErrNotLocked, 实际 %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Mutex("expiry").Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = Mutex("expiry").Unlock(ctx)
+}
+
+func TestSingleInstance(t *testing.T) {
+	other := openFile(t, "instance")
+	if err := other.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	_, err := SingleInstance(context.TODO(), "instance")
+	var running *RunningError
+	if !errors.As(err, &running) || !errors.Is(err, ErrAlreadyRunning) {
+		t.Fatalf("期望 RunningError, 实际 %v", err)
+	} else if running.Holder == nil || running.Holder.Pid != os.Getpid() {
+		t.Fatalf("未报告已运行实例的 pid: %+v", running.Holder)
+	}
+
+	released := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() {
+		_ = other.Unlock(context.TODO())
+		close(released)
+	})
+	defer func() { <-released }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pidFile := filepath.Join(flock.directory, "instance.pid")
+	instance, err := SingleInstance(ctx, "instance", WithWait(), WithPidFile(pidFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(pidFile); err != nil || string(b) != fmt.Sprintf("%d\n", os.Getpid()) {
+		t.Fatalf("pid 文件错误: %q, %v", b, err)
+	}
+	if err = instance.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Fatalf("释放后应删除 pid 文件: %v", err)
+	}
+
+	// 未等待直接获取时持有者信息中同样记录 pid
+	if instance, err = SingleInstance(ctx, "instance-fast"); err != nil {
+		t.Fatal(err)
+	}
+	defer instance.Release() // nolint
+	if holder, err := ReadHolder("instance-fast"); err != nil || holder == nil || holder.Value != fmt.Sprint(os.Getpid()) {
+		t.Fatalf("持有者信息缺少 pid: %+v, %v", holder, err)
+	}
+}
+
+func TestRangeMutex(t *testing.T) {
+	other := &rwLock{directory: flock.directory, ranges: newShards(flock.directory, 16)}
+	defer func() {
+		for _, shard := range other.ranges {
+			shard.shutdown()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 写锁与另一个描述互斥
+	holder := other.rangeAllocation("user-1", &rwlock.Options{})
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctx2, cancel2 := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel2()
+	if err := RangeMutex("user-1").Lock(ctx2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望超时, 实际 %v", err)
+	}
+	if err := RangeMutex("user-2").Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = RangeMutex("user-2").Unlock(ctx)
+	_ = holder.Unlock(ctx)
+	if err := RangeMutex("user-1").Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = RangeMutex("user-1").Unlock(ctx)
+
+	// 读锁共享, 写锁等待所有读锁释放
+	if err := holder.RLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mutex := RangeRWMutex("user-1")
+	for i := 0; i < 2; i++ {
+		if err := mutex.RLock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mutex.Lock(ctx2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望超时, 实际 %v", err)
+	}
+	_ = mutex.RUnlock(ctx)
+	_ = mutex.RUnlock(ctx)
+	_ = holder.RUnlock(ctx)
+	if err := mutex.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := mutex.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 限制尝试次数时不会一直等待
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := RangeMutex("user-1", rwlock.WithTries(2)).Lock(ctx); !errors.Is(err, rwlock.ErrFailed) {
+		t.Fatalf("期望获取失败, 实际 %v", err)
+	}
+	_ = holder.Unlock(ctx)
+	tries := RangeMutex("user-1", rwlock.WithTries(2))
+	if err := tries.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tries.Lock(ctx); !errors.Is(err, rwlock.ErrFailed) {
+		t.Fatalf("进程内竞争应计入尝试次数, 实际 %v", err)
+	}
+	_ = tries.Unlock(ctx)
+	if err := RangeMutex("user-1", rwlock.WithExpiry(time.Second)).Lock(ctx); !errors.Is(err, ErrUnsupportedOption) {
+		t.Fatalf("不支持的选项应返回错误, 实际 %v", err)
+	}
+}
+
+func TestRangeMutexMany(t *testing.T) {
+	var wg sync.WaitGroup
+	counts := make([]int, 100)
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+	defer cancel()
+	for i := 0; i < 10000; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mutex := RangeMutex(fmt.Sprintf("user-%d", i%len(counts)))
+			if err := mutex.Lock(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+			counts[i%len(counts)]++
+			_ = mutex.Unlock(ctx)
+		}(i)
+	}
+	wg.Wait()
+	for i, n := range counts {
+		if n != 100 {
+			t.Fatalf("user-%d 执行 %d 次", i, n)
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(flock.directory, "ranges-*.lock"))
+	if len(matches) > 16 {
+		t.Fatalf("分片文件数量 %d", len(matches))
+	}
+}
+
+func TestLeaseMutex(t *testing.T) {
+	var renewed int32
+	mutex := LeaseMutex("lease", rwlock.WithExpiry(300*time.Millisecond),
+		rwlock.WithOnRenewal(func(r *rwlock.Renewal) {
+			if r.Result {
+				atomic.AddInt32(&renewed, 1)
+			}
+		}))
+	other := &rwLock{directory: flock.directory, leases: make(map[string]*rwLease)}
+	host := other.leaseAllocation("lease", &rwlock.Options{Expiry: time.Second, Tries: 2})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := mutex.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 持有期间续租, 其他主机无法获取
+	time.Sleep(time.Second)
+	if err := host.Lock(ctx); err == nil {
+		t.Fatal("租约有效期间不应获取成功")
+	}
+	if atomic.LoadInt32(&renewed) == 0 {
+		t.Fatal("未续租")
+	}
+	if err := mutex.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := host.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := host.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeaseSteal(t *testing.T) {
+	// 模拟崩溃的主机留下的过期租约
+	path := filepath.Join(flock.directory, "lease-steal.lease")
+	holder := newHolder("crashed")
+	tmp, err := writeLease(path, holder, &rwlock.Options{Expiry: -time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	mutex := LeaseMutex("lease-steal", rwlock.WithTries(1))
+	// 其他主机正在接管时不移动租约
+	marker := path + "." + holder.Token + ".steal"
+	if err = os.WriteFile(marker, nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err = mutex.Lock(context.TODO()); !errors.Is(err, rwlock.ErrFailed) {
+		t.Fatalf("接管标记存在时应获取失败: %v", err)
+	}
+	if current, _ := readLease(path); current == nil || current.Token != holder.Token {
+		t.Fatalf("租约不应被移动: %+v", current)
+	}
+	if err = os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	if err = mutex.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("接管后应删除标记: %v", err)
+	}
+	current, err := readLease(path)
+	if err != nil || current.Token == holder.Token {
+		t.Fatalf("未接管过期租约: %+v, %v", current, err)
+	}
+	if err = mutex.Unlock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("释放后应删除租约文件: %v", err)
+	}
+}
+
+// 租约正在被接管时续租失败, 不会覆盖接管者写入的租约
+func TestLeaseRenewDuringSteal(t *testing.T) {
+	renewed := make(chan bool, 10)
+	mutex := LeaseMutex("lease-renew", rwlock.WithExpiry(300*time.Millisecond),
+		rwlock.WithOnRenewal(func(r *rwlock.Renewal) {
+			renewed <- r.Result
+		}))
+	if err := mutex.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	lease := mutex.(*rwLease)
+	marker := lease.path + "." + lease.holder.Token + ".steal"
+	if err := os.WriteFile(marker, nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(marker) // nolint
+	select {
+	case ok := <-renewed:
+		if ok {
+			t.Fatal("接管期间不应续租成功")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未续租")
+	}
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	if err := mutex.Unlock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPathMutex(t *testing.T) {
+	if _, err := exec.LookPath("flock"); err != nil {
+		t.Skip(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	// flock(1) 非阻塞加锁的结果
+	flock1 := func(mode string) bool {
+		return exec.Command("flock", mode, "-n", path, "true").Run() == nil
+	}
+	if err := PathMutex(path).Lock(context.TODO()); err == nil {
+		t.Fatal("路径不存在时应失败")
+	}
+	mutex := PathRWMutex(path, WithCreate(0o644))
+	if err := mutex.Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if flock1("-s") {
+		t.Fatal("持有排他锁时 flock(1) 不应获取成功")
+	}
+	if err := mutex.Unlock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if err := mutex.RLock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if !flock1("-s") || flock1("-x") {
+		t.Fatal("持有共享锁时 flock(1) 只能获取共享锁")
+	}
+	if err := mutex.RUnlock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if !flock1("-x") {
+		t.Fatal("释放后 flock(1) 应获取成功")
+	}
+
+	// flock(1) 持有期间等待, 释放后立即获取
+	cmd := exec.Command("flock", "-x", path, "sleep", "0.3")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait() // nolint
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if err := PathMutex(path).Lock(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("应等待 flock(1) 释放")
+	}
+	_ = PathMutex(path).Unlock(context.TODO())
+}
+
+func TestUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	increment := func(old []byte) ([]byte, error) {
+		var n int
+		if len(old) > 0 {
+			if _, err := fmt.Sscan(string(old), &n); err != nil {
+				return nil, err
+			}
+		}
+		return []byte(fmt.Sprint(n + 1)), nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := Update(context.TODO(), path, increment, WithBackup(".bak")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if b, _ := os.ReadFile(path); string(b) != "100" {
+		t.Fatalf("计数结果 %s", b)
+	}
+	if b, _ := os.ReadFile(path + ".bak"); string(b) != "99" {
+		t.Fatalf("备份内容 %s", b)
+	}
+
+	err := Update(context.TODO(), path, func(old []byte) ([]byte, error) {
+		time.Sleep(200 * time.Millisecond)
+		return []byte("timeout"), nil
+	}, WithMaxHold(50*time.Millisecond))
+	if !errors.Is(err, ErrHoldTimeout) {
+		t.Fatalf("期望持有超时, 实际 %v", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "100" {
+		t.Fatalf("超时后不应写入: %s", b)
+	}
+
+	// 修改符号链接指向的文件, 链接本身保留
+	link := filepath.Join(filepath.Dir(path), "link")
+	if err = os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	if err = Update(context.TODO(), link, increment); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("符号链接被替换: %v", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "101" {
+		t.Fatalf("链接指向的文件未更新: %s", b)
+	}
+
+	// 创建权限只作用于本次调用
+	created := filepath.Join(filepath.Dir(path), "created")
+	if err = Update(context.TODO(), created, increment); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove(created)
+	if err = PathMutex(created).Lock(context.TODO()); !os.IsNotExist(err) {
+		t.Fatalf("未设置 WithCreate 时不应创建文件: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrHoldTimeout = errors.New("file lock held too long")
+
+type updateOptions struct {
+	mode    os.FileMode
+	backup  string
+	maxHold time.Duration
+}
+
+type UpdateOption func(o *updateOptions)
+
+// 新文件的权限, 默认沿用原文件, 文件不存在时为 0644
+func WithMode(mode os.FileMode) UpdateOption {
+	return func(o *updateOptions) {
+		o.mode = mode
+	}
+}
+
+// 写入前将原内容备份到 path+suffix
+func WithBackup(suffix string) UpdateOption {
+	return func(o *updateOptions) {
+		o.backup = suffix
+	}
+}
+
+// 持有锁的最长时间, 超时后放弃本次修改并释放锁
+func WithMaxHold(d time.Duration) UpdateOption {
+	return func(o *updateOptions) {
+		o.maxHold = d
+	}
+}
+
+// Update 在文件锁的保护下读取、修改并原子地写回文件
+// 新内容先写入同目录的临时文件并 fsync, 再改名覆盖原文件, 最后 fsync 目录
+// fn 返回错误或内容未变化时不写入, 文件不存在时 old 为空
+// path 为符号链接时修改链接指向的文件, 新文件沿用原文件的属主
+func Update(ctx context.Context, path string, fn func(old []byte) ([]byte, error), opts ...UpdateOption) (err error) {
+	// 改名会用普通文件替换符号链接本身, 需要对链接指向的文件操作
+	if resolved, rerr := filepath.EvalSymlinks(path); rerr == nil {
+		path = resolved
+	} else if !os.IsNotExist(rerr) {
+		return rerr
+	}
+	o := &updateOptions{mode: 0o644}
+	stat, serr := os.Stat(path)
+	if serr == nil {
+		o.mode = stat.Mode().Perm()
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	mutex := PathMutex(path, WithCreate(o.mode))
+	if err = mutex.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := mutex.Unlock(ctx); err == nil {
+			err = uerr
+		}
+	}()
+	hold := ctx
+	if o.maxHold > 0 {
+		var cancel context.CancelFunc
+		hold, cancel = context.WithTimeout(ctx, o.maxHold)
+		defer cancel()
+	}
+
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := fn(old)
+		done <- result{data, err}
+	}()
+	var data []byte
+	select {
+	case r := <-done:
+		if r.err != nil || bytes.Equal(r.data, old) {
+			return r.err
+		}
+		data = r.data
+	case <-hold.Done():
+		return holdErr(ctx, hold)
+	}
+
+	if o.backup != "" {
+		if err = writeFile(ctx, hold, path+o.backup, old, o.mode, stat); err != nil {
+			return err
+		}
+	}
+	return writeFile(ctx, hold, path, data, o.mode, stat)
+}
+
+// 写入临时文件后改名覆盖, 保证其他进程只会看到完整的旧内容或新内容
+// owner 不为 nil 时新文件沿用其属主
+func writeFile(ctx, hold context.Context, path string, data []byte, mode os.FileMode, owner os.FileInfo) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint
+	if _, err = tmp.Write(data); err == nil {
+		if err = tmp.Chmod(mode); err == nil && owner != nil {
+			err = chown(tmp, owner)
+		}
+		if err == nil {
+			err = tmp.Sync()
+		}
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	} else if hold.Err() != nil {
+		return holdErr(ctx, hold)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// 区分调用方取消与超出最长持有时间
+func holdErr(ctx, hold context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return ErrHoldTimeout
+}
@@ -0,0 +1,136 @@
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/J-guanghua/rwlock"
+	"github.com/J-guanghua/rwlock/file"
+)
+
+// 提名记录, 同一主机上的进程共用时钟
+type nomination struct {
+	Identity string    `json:"identity"`
+	Until    time.Time `json:"until"`
+}
+
+// 通过 file.Mutex(name) 当选, 记录保存在锁目录下的 name.leader 文件中
+// 只有锁的持有者进程存活时才视为有 Leader, 进程退出时内核释放锁
+type fileBackend struct{}
+
+func FileBackend() BlockingBackend {
+	return fileBackend{}
+}
+
+func (b fileBackend) TryAcquire(ctx context.Context, name, identity string, _ time.Duration) (*LeaderRecord, error) {
+	return b.acquire(ctx, name, identity, 1)
+}
+
+// 阻塞在 flock 上, Leader 释放或进程退出后内核立即唤醒
+func (b fileBackend) Acquire(ctx context.Context, name, identity string, _ time.Duration) (*LeaderRecord, error) {
+	return b.acquire(ctx, name, identity, 0)
+}
+
+func (fileBackend) acquire(ctx context.Context, name, identity string, tries int) (*LeaderRecord, error) {
+	path, err := file.Path(name, ".leader")
+	if err != nil {
+		return nil, err
+	}
+	mutex := file.Mutex(name)
+	if err = mutex.Lock(rwlock.WithContext(ctx, &rwlock.Options{Tries: tries, Value: identity})); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	record := &LeaderRecord{Identity: identity, AcquiredAt: now, RenewedAt: now, Endpoint: EndpointFromContext(ctx)}
+	err = file.Update(ctx, path, func(old []byte) ([]byte, error) {
+		last := &LeaderRecord{}
+		if len(old) > 0 {
+			// 记录损坏时任期从头开始
+			_ = json.Unmarshal(old, last)
+		}
+		record.Term = last.Term + 1
+		return json.Marshal(record)
+	})
+	if err != nil {
+		// 没有可用的任期, 放弃本次当选
+		_ = mutex.Unlock(ctx)
+		return nil, err
+	}
+	return record, nil
+}
+
+// 文件锁不会过期, 续期只更新时间供观察者参考
+func (fileBackend) Renew(ctx context.Context, name string, record *LeaderRecord, _ time.Duration) error {
+	path, err := file.Path(name, ".leader")
+	if err != nil {
+		return err
+	}
+	renewedAt := time.Now()
+	err = file.Update(ctx, path, func(old []byte) ([]byte, error) {
+		current := &LeaderRecord{}
+		if err := json.Unmarshal(old, current); err != nil {
+			return nil, err
+		} else if current.Identity != record.Identity || current.Term != record.Term {
+			return nil, ErrNotLeader
+		}
+		current.RenewedAt = renewedAt
+		return json.Marshal(current)
+	})
+	if err == nil {
+		record.RenewedAt = renewedAt
+	}
+	return err
+}
+
+func (fileBackend) Release(ctx context.Context, name string, _ *LeaderRecord) error {
+	return file.Mutex(name).Unlock(ctx)
+}
+
+func (fileBackend) Get(_ context.Context, name string) (*LeaderRecord, error) {
+	holder, err := file.ReadHolder(name)
+	if err != nil || holder == nil || holder.Stale() {
+		return nil, err
+	}
+	path, err := file.Path(name, ".leader")
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	record := &LeaderRecord{}
+	return record, json.Unmarshal(b, record)
+}
+
+func (fileBackend) Nominate(ctx context.Context, name, identity string, window time.Duration) error {
+	path, err := file.Path(name, ".nominee")
+	if err != nil {
+		return err
+	}
+	return file.Update(ctx, path, func([]byte) ([]byte, error) {
+		return json.Marshal(&nomination{Identity: identity, Until: time.Now().Add(window)})
+	})
+}
+
+func (fileBackend) Nominee(_ context.Context, name string) (string, error) {
+	path, err := file.Path(name, ".nominee")
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	n := &nomination{}
+	if err = json.Unmarshal(b, n); err != nil || time.Now().After(n.Until) {
+		return "", err
+	}
+	return n.Identity, nil
+}
@@ -0,0 +1,159 @@
+package leaderelection
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/J-guanghua/rwlock"
+)
+
+// 通过 Mutex 当选时等待加锁的时长
+const acquireTimeout = 200 * time.Millisecond
+
+// Locker 创建选举使用的锁, 与 redis.Mutex、db.Mutex、file.LeaseMutex 等的签名一致
+type Locker func(name string, opts ...rwlock.Option) rwlock.Mutex
+
+// 将任意 Mutex 适配为选举后端, 续期依赖 Mutex 自身的续期机制, OnRenewal 报告锁已丢失后 Renew 返回 ErrNotLeader
+// 记录只保存在本进程内, Get 只能查询到本进程当选的 Leader, 任期在进程内递增, 不同进程的任期不可比较
+// 需要跨进程单调递增的任期 (如作为栅栏令牌) 时使用 RedisBackend、MysqlBackend 或 FileBackend
+type mutexBackend struct {
+	locker    Locker
+	mtx       sync.Mutex
+	elections map[string]*mutexElection
+}
+
+// 每个名称的选举状态, 释放后保留以便任期继续递增
+type mutexElection struct {
+	term   int64
+	record *LeaderRecord
+	// 当前任期持有的锁, cancel 结束加锁时传入的上下文, 停止锁的续期
+	mutex  rwlock.Mutex
+	cancel context.CancelFunc
+	lost   bool
+	// 进程内的提名
+	nominee string
+	until   time.Time
+}
+
+// MutexBackend 以 locker 创建的锁选举, 同一名称的锁应由该后端首次创建, 否则收不到续期结果
+func MutexBackend(locker Locker) ElectionBackend {
+	return &mutexBackend{locker: locker}
+}
+
+// 调用方需持有 mtx
+func (b *mutexBackend) election(name string) *mutexElection {
+	if b.elections == nil {
+		b.elections = make(map[string]*mutexElection)
+	}
+	if b.elections[name] == nil {
+		b.elections[name] = &mutexElection{}
+	}
+	return b.elections[name]
+}
+
+// 锁的续期失败时标记该名称的当前任期已失去领导权
+func (b *mutexBackend) onRenewal(name string, r *rwlock.Renewal) {
+	if r.Result || r.Ctx.Err() != nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if e := b.election(name); e.record != nil {
+		e.lost = true
+	}
+}
+
+// 加锁的上下文持续整个任期, 只在等待期间限制 acquireTimeout
+func (b *mutexBackend) TryAcquire(ctx context.Context, name, identity string, _ time.Duration) (*LeaderRecord, error) {
+	mutex := b.locker(name, rwlock.WithOnRenewal(func(r *rwlock.Renewal) {
+		b.onRenewal(name, r)
+	}))
+	lockCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- mutex.Lock(lockCtx)
+	}()
+	var err error
+	timer := time.NewTimer(acquireTimeout)
+	select {
+	case err = <-done:
+		timer.Stop()
+	case <-timer.C:
+		cancel()
+		if err = <-done; err == nil {
+			// 取消的同时获取成功, 续期已停止, 放弃本次当选
+			_ = mutex.Unlock(context.Background())
+		}
+		err = rwlock.ErrFailed
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	e := b.election(name)
+	e.term++
+	now := time.Now()
+	e.record = &LeaderRecord{Identity: identity, AcquiredAt: now, Term: e.term, RenewedAt: now,
+		Endpoint: EndpointFromContext(ctx)}
+	e.mutex, e.cancel, e.lost = mutex, cancel, false
+	record := *e.record
+	return &record, nil
+}
+
+func (b *mutexBackend) Renew(_ context.Context, name string, record *LeaderRecord, _ time.Duration) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	e := b.election(name)
+	if e.record == nil || e.record.Term != record.Term || e.lost {
+		return ErrNotLeader
+	}
+	record.RenewedAt = time.Now()
+	e.record.RenewedAt = record.RenewedAt
+	return nil
+}
+
+func (b *mutexBackend) Release(ctx context.Context, name string, record *LeaderRecord) error {
+	b.mtx.Lock()
+	e := b.election(name)
+	if e.record == nil || e.record.Term != record.Term {
+		b.mtx.Unlock()
+		return ErrNotLeader
+	}
+	mutex, cancel := e.mutex, e.cancel
+	e.record, e.mutex, e.cancel = nil, nil, nil
+	b.mtx.Unlock()
+	defer cancel()
+	return mutex.Unlock(ctx)
+}
+
+func (b *mutexBackend) Get(_ context.Context, name string) (*LeaderRecord, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	e := b.election(name)
+	if e.record == nil {
+		return nil, nil
+	}
+	record := *e.record
+	return &record, nil
+}
+
+func (b *mutexBackend) Nominate(_ context.Context, name, identity string, window time.Duration) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	e := b.election(name)
+	e.nominee, e.until = identity, time.Now().Add(window)
+	return nil
+}
+
+func (b *mutexBackend) Nominee(_ context.Context, name string) (string, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	e := b.election(name)
+	if time.Now().After(e.until) {
+		return "", nil
+	}
+	return e.nominee, nil
+}
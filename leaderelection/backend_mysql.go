@@ -0,0 +1,155 @@
+package leaderelection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/J-guanghua/rwlock/db"
+)
+
+const leaderTable = `CREATE TABLE IF NOT EXISTS rwlock_leader (
+	name VARCHAR(64) NOT NULL PRIMARY KEY,
+	identity VARCHAR(255) NOT NULL,
+	term BIGINT UNSIGNED NOT NULL,
+	acquired_at DATETIME(6) NOT NULL,
+	renewed_at DATETIME(6) NOT NULL,
+	expires_at DATETIME(6) NOT NULL,
+	endpoint VARCHAR(255) NOT NULL DEFAULT '',
+	nominee VARCHAR(255) NOT NULL DEFAULT '',
+	nominated_until DATETIME(6) NULL
+)`
+
+// 通过 GET_LOCK 当选, 记录保存在锁所在的数据库中, GET_LOCK 仍被持有且记录未过期时才视为有 Leader
+// 会话断开时 MySQL 自动释放锁, 续期时确认锁仍由当前会话持有, 会话存活但停止续期的 Leader 在记录过期后对观察者不可见
+type mysqlBackend struct{}
+
+func MysqlBackend() ElectionBackend {
+	return mysqlBackend{}
+}
+
+func (mysqlBackend) db(ctx context.Context, name string) (*sql.DB, string, error) {
+	key, err := db.Key(name)
+	if err != nil {
+		return nil, "", err
+	}
+	d := db.DB(name)
+	if err = db.EnsureTable(ctx, d, leaderTable); err != nil {
+		return nil, "", err
+	}
+	return d, key, nil
+}
+
+func (b mysqlBackend) TryAcquire(ctx context.Context, name, identity string, ttl time.Duration) (*LeaderRecord, error) {
+	d, key, err := b.db(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	// 不等待其他节点释放, 避免长时间占用数据库唯一的连接
+	if err = db.TryLock(ctx, name); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	record := &LeaderRecord{Identity: identity, AcquiredAt: now, RenewedAt: now, Endpoint: EndpointFromContext(ctx)}
+	_, err = d.ExecContext(ctx, `INSERT INTO rwlock_leader (name, identity, term, acquired_at, renewed_at, expires_at, endpoint)
+		VALUES (?, ?, 1, ?, ?, NOW(6) + INTERVAL ? MICROSECOND, ?)
+		ON DUPLICATE KEY UPDATE identity = VALUES(identity), term = term + 1, acquired_at = VALUES(acquired_at),
+		renewed_at = VALUES(renewed_at), expires_at = VALUES(expires_at), endpoint = VALUES(endpoint)`,
+		key, identity, now, now, ttl.Microseconds(), record.Endpoint)
+	if err == nil {
+		err = d.QueryRowContext(ctx, "SELECT term FROM rwlock_leader WHERE name = ?", key).Scan(&record.Term)
+	}
+	if err != nil {
+		// 没有可用的任期, 放弃本次当选
+		_ = db.Mutex(name).Unlock(ctx)
+		return nil, err
+	}
+	return record, nil
+}
+
+func (b mysqlBackend) Renew(ctx context.Context, name string, record *LeaderRecord, ttl time.Duration) error {
+	d, key, err := b.db(ctx, name)
+	if err != nil {
+		return err
+	}
+	var held sql.NullBool
+	if err = d.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", key).Scan(&held); err != nil {
+		return err
+	} else if !held.Bool {
+		return ErrNotLeader
+	}
+	renewedAt := time.Now()
+	result, err := d.ExecContext(ctx, `UPDATE rwlock_leader SET renewed_at = ?, expires_at = NOW(6) + INTERVAL ? MICROSECOND
+		WHERE name = ? AND identity = ? AND term = ?`,
+		renewedAt, ttl.Microseconds(), key, record.Identity, record.Term)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotLeader
+	}
+	record.RenewedAt = renewedAt
+	return nil
+}
+
+// 确认记录仍属于当前任期后使记录过期并释放锁, 避免释放同一进程内其他候选者持有的锁
+func (b mysqlBackend) Release(ctx context.Context, name string, record *LeaderRecord) error {
+	d, key, err := b.db(ctx, name)
+	if err != nil {
+		return err
+	}
+	result, err := d.ExecContext(ctx, "UPDATE rwlock_leader SET expires_at = NOW(6) WHERE name = ? AND identity = ? AND term = ?",
+		key, record.Identity, record.Term)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotLeader
+	}
+	return db.Mutex(name).Unlock(ctx)
+}
+
+func (b mysqlBackend) Get(ctx context.Context, name string) (*LeaderRecord, error) {
+	d, key, err := b.db(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	record := &LeaderRecord{}
+	err = d.QueryRowContext(ctx, `SELECT identity, term, acquired_at, renewed_at, endpoint FROM rwlock_leader
+		WHERE name = ? AND expires_at > NOW(6) AND IS_USED_LOCK(?) IS NOT NULL`, key, key).
+		Scan(&record.Identity, &record.Term, &record.AcquiredAt, &record.RenewedAt, &record.Endpoint)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return record, err
+}
+
+// 提名窗口以数据库时间计算, 不受各节点时钟偏差影响
+func (b mysqlBackend) Nominate(ctx context.Context, name, identity string, window time.Duration) error {
+	d, key, err := b.db(ctx, name)
+	if err != nil {
+		return err
+	}
+	_, err = d.ExecContext(ctx, `UPDATE rwlock_leader SET nominee = ?,
+		nominated_until = NOW(6) + INTERVAL ? MICROSECOND WHERE name = ?`, identity, window.Microseconds(), key)
+	return err
+}
+
+func (b mysqlBackend) Nominee(ctx context.Context, name string) (string, error) {
+	d, key, err := b.db(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	var nominee string
+	err = d.QueryRowContext(ctx, "SELECT nominee FROM rwlock_leader WHERE name = ? AND nominated_until > NOW(6)",
+		key).Scan(&nominee)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return nominee, err
+}
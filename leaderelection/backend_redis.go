@@ -0,0 +1,133 @@
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/J-guanghua/rwlock"
+	rwredis "github.com/J-guanghua/rwlock/redis"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// Lua 脚本, 没有 Leader 时递增任期并写入记录, 返回任期
+	acquireScript = redis.NewScript(`
+		if redis.call("EXISTS", KEYS[1]) == 1 then
+			return false
+		end
+		local term = redis.call("INCR", KEYS[2])
+		local record = cjson.encode({identity = ARGV[1], term = term, acquired_at = ARGV[2], renewed_at = ARGV[2],
+			endpoint = ARGV[4]})
+		redis.call("SET", KEYS[1], record, "PX", ARGV[3])
+		return term
+	`)
+	// Lua 脚本, 确认记录仍属于当前任期后更新续期时间和过期时间
+	renewScript = redis.NewScript(`
+		local val = redis.call("GET", KEYS[1])
+		if not val then
+			return 0
+		end
+		local record = cjson.decode(val)
+		if record.identity ~= ARGV[1] or record.term ~= tonumber(ARGV[2]) then
+			return 0
+		end
+		record.renewed_at = ARGV[3]
+		redis.call("SET", KEYS[1], cjson.encode(record), "PX", ARGV[4])
+		return 1
+	`)
+	// Lua 脚本, 确认记录仍属于当前任期后删除
+	releaseScript = redis.NewScript(`
+		local val = redis.call("GET", KEYS[1])
+		if not val then
+			return 0
+		end
+		local record = cjson.decode(val)
+		if record.identity ~= ARGV[1] or record.term ~= tonumber(ARGV[2]) then
+			return 0
+		end
+		return redis.call("DEL", KEYS[1])
+	`)
+)
+
+// 记录本身即是锁, 带有过期时间, Leader 停止续期后自动消失
+// 任期保存在单独的键中且不过期, 记录过期后任期仍然递增
+type redisBackend struct{}
+
+func RedisBackend() ElectionBackend {
+	return redisBackend{}
+}
+
+func (redisBackend) key(name string) string {
+	return "leader:" + name
+}
+
+func (redisBackend) termKey(name string) string {
+	return "leader-term:" + name
+}
+
+func (redisBackend) nomineeKey(name string) string {
+	return "leader-nominee:" + name
+}
+
+func (b redisBackend) TryAcquire(ctx context.Context, name, identity string, ttl time.Duration) (*LeaderRecord, error) {
+	now := time.Now()
+	term, err := acquireScript.Run(ctx, rwredis.Client(name), []string{b.key(name), b.termKey(name)},
+		identity, now.Format(time.RFC3339Nano), ttl.Milliseconds(), EndpointFromContext(ctx)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return nil, rwlock.ErrFailed
+	} else if err != nil {
+		return nil, err
+	}
+	return &LeaderRecord{Identity: identity, AcquiredAt: now, Term: term, RenewedAt: now,
+		Endpoint: EndpointFromContext(ctx)}, nil
+}
+
+func (b redisBackend) Renew(ctx context.Context, name string, record *LeaderRecord, ttl time.Duration) error {
+	renewedAt := time.Now()
+	result, err := renewScript.Run(ctx, rwredis.Client(name), []string{b.key(name)}, record.Identity,
+		strconv.FormatInt(record.Term, 10), renewedAt.Format(time.RFC3339Nano), ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	} else if result == 0 {
+		return ErrNotLeader
+	}
+	record.RenewedAt = renewedAt
+	return nil
+}
+
+func (b redisBackend) Release(ctx context.Context, name string, record *LeaderRecord) error {
+	result, err := releaseScript.Run(ctx, rwredis.Client(name), []string{b.key(name)}, record.Identity,
+		strconv.FormatInt(record.Term, 10)).Int()
+	if err != nil {
+		return err
+	} else if result == 0 {
+		return ErrNotLeader
+	}
+	return nil
+}
+
+func (b redisBackend) Get(ctx context.Context, name string) (*LeaderRecord, error) {
+	val, err := rwredis.Client(name).Get(ctx, b.key(name)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	record := &LeaderRecord{}
+	return record, json.Unmarshal(val, record)
+}
+
+func (b redisBackend) Nominate(ctx context.Context, name, identity string, window time.Duration) error {
+	return rwredis.Client(name).Set(ctx, b.nomineeKey(name), identity, window).Err()
+}
+
+func (b redisBackend) Nominee(ctx context.Context, name string) (string, error) {
+	nominee, err := rwredis.Client(name).Get(ctx, b.nomineeKey(name)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return nominee, err
+}
@@ -0,0 +1,109 @@
+package leaderelection
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// 重试间隔的随机增量比例, 避免各节点同时竞选
+	jitterFactor = 0.2
+	// 失去领导权后释放锁的超时时间, 此时选举的 ctx 已经结束
+	releaseTimeout = 5 * time.Second
+)
+
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration(rand.Float64()*jitterFactor*float64(d))
+}
+
+// 一次任期, 记录 OnStartedLeading 协程并决定结束时是否释放锁
+type term struct {
+	releaseOnCancel bool
+	leading         sync.WaitGroup
+	// 当选后为 1, 只有当选期间处理 resign
+	elected int32
+	resign  chan *resignation
+	// 竞选结束后关闭
+	done chan struct{}
+	// 当选期间的记录和续期开始连续失败的时间, 供 Status 查询
+	mtx     sync.Mutex
+	record  *LeaderRecord
+	failing time.Time
+}
+
+func newTerm(releaseOnCancel bool) *term {
+	return &term{releaseOnCancel: releaseOnCancel, resign: make(chan *resignation), done: make(chan struct{})}
+}
+
+func (t *term) lead(ctx context.Context, fn func(ctx context.Context)) {
+	t.leading.Add(1)
+	go func() {
+		defer t.leading.Done()
+		fn(ctx)
+	}()
+}
+
+// 失去领导权时总是释放, 父 ctx 结束时由 releaseOnCancel 决定
+func (t *term) release(ctx context.Context, backend ElectionBackend, name string, record *LeaderRecord) {
+	if ctx.Err() != nil && !t.releaseOnCancel {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	_ = backend.Release(ctx, name, record)
+}
+
+// Elector 循环参与选举, 失去领导权后等待 OnStartedLeading 返回再重新竞选, 直到 ctx 结束
+type Elector struct {
+	Backend ElectionBackend
+	Name    string
+	Config  LeaderElectionConfig
+	// ctx 结束时主动放弃领导权, 其他节点可以立即当选
+	// 否则 redis 等待记录过期, mysql 和文件锁在进程退出时释放
+	ReleaseOnCancel bool
+
+	mtx     sync.Mutex
+	current *term
+}
+
+// 创建时确定 IdentityID, Run 之前即可查询 Status
+func NewElector(backend ElectionBackend, name string, configuration LeaderElectionConfig) *Elector {
+	configuration.Init()
+	configuration.GetIdentityID()
+	return &Elector{Backend: backend, Name: name, Config: configuration}
+}
+
+func NewRedisElector(name string, configuration LeaderElectionConfig) *Elector {
+	return NewElector(RedisBackend(), name, withRegistry(configuration, RedisRegistry()))
+}
+
+func NewFileElector(name string, configuration LeaderElectionConfig) *Elector {
+	return NewElector(FileBackend(), name, withRegistry(configuration, FileRegistry()))
+}
+
+func NewMysqlElector(name string, configuration LeaderElectionConfig) *Elector {
+	return NewElector(MysqlBackend(), name, withRegistry(configuration, MysqlRegistry()))
+}
+
+// Run 阻塞直到 ctx 结束, 每次重新竞选使用同一个 IdentityID
+func (e *Elector) Run(ctx context.Context) {
+	e.Config.Init()
+	e.Config.GetIdentityID()
+	defer candidate(ctx, e.Name, e.Config)()
+	for {
+		t := newTerm(e.ReleaseOnCancel)
+		e.mtx.Lock()
+		e.current = t
+		e.mtx.Unlock()
+		runOrDie(ctx, e.Backend, e.Name, e.Config, t)
+		close(t.done)
+		t.leading.Wait()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jitter(e.Config.RetryPeriod)):
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package leaderelection
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+)
+
+// 转发的请求带有该请求头, 值为转发者的 Identity
+// 收到转发请求的节点已不是 Leader 时返回 503 并带上该请求头, 转发者据此重试, 避免多次转发
+const forwardedHeader = "X-Leader-Forwarded-By"
+
+var errLeaderMoved = errors.New("leadership moved during forwarding")
+
+// 默认缓存的请求体上限
+const defaultMaxBody = 10 << 20
+
+type forwarder struct {
+	elector   *Elector
+	next      http.Handler
+	retries   int
+	interval  time.Duration
+	transport http.RoundTripper
+	maxBody   int64
+}
+
+type ForwardOption func(f *forwarder)
+
+// 没有 Leader 或转发失败时的重试次数和间隔, 默认重试 3 次, 间隔为 RetryPeriod
+func WithForwardRetries(retries int, interval time.Duration) ForwardOption {
+	return func(f *forwarder) {
+		f.retries, f.interval = retries, interval
+	}
+}
+
+// 转发请求使用的 Transport, 默认为 http.DefaultTransport
+func WithForwardTransport(transport http.RoundTripper) ForwardOption {
+	return func(f *forwarder) {
+		f.transport = transport
+	}
+}
+
+// 缓存的请求体上限, 超过时返回 413, 默认 10MB
+func WithForwardMaxBody(n int64) ForwardOption {
+	return func(f *forwarder) {
+		f.maxBody = n
+	}
+}
+
+// ForwardHandler 当选时由 next 处理请求, 否则转发给记录中 Endpoint 指向的 Leader
+// Leader 在处理前失去领导权或连接失败时重新查询 Leader 并重试, 请求体会缓存在内存中以便重试
+// 请求可能已到达 Leader 的其他失败只重试幂等的请求, 否则返回 502, 避免重复执行
+func (e *Elector) ForwardHandler(next http.Handler, opts ...ForwardOption) http.Handler {
+	f := &forwarder{elector: e, next: next, retries: 3, interval: e.Config.RetryPeriod, maxBody: defaultMaxBody}
+	for _, o := range opts {
+		o(f)
+	}
+	if f.transport == nil {
+		f.transport = http.DefaultTransport
+	}
+	return f
+}
+
+func (e *Elector) leading() bool {
+	t := e.currentTerm()
+	if t == nil {
+		return false
+	}
+	record, _ := t.status()
+	return record != nil
+}
+
+func (f *forwarder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, f.maxBody))
+	if err != nil && int64(len(body)) >= f.maxBody {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_ = r.Body.Close()
+	for attempt := 0; ; attempt++ {
+		if f.elector.leading() {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			f.next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get(forwardedHeader) != "" {
+			// 已被转发过一次, 交给转发者重试
+			w.Header().Set(forwardedHeader, f.elector.Config.IdentityID)
+			http.Error(w, ErrNotLeader.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		record, err := f.elector.Backend.Get(r.Context(), f.elector.Name)
+		if err == nil && (record == nil || record.Endpoint == "") {
+			err = errors.New("no leader endpoint available")
+		}
+		if err == nil {
+			if err = f.forward(w, r, body, record.Endpoint); err == nil {
+				return
+			} else if !retryable(r, err) {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+		}
+		if attempt >= f.retries {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(jitter(f.interval)):
+		}
+	}
+}
+
+// 转发给 endpoint, 返回 nil 表示已写入响应
+func (f *forwarder) forward(w http.ResponseWriter, r *http.Request, body []byte, endpoint string) error {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	var failed error
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Host = target.Host
+		req.Header.Set(forwardedHeader, f.elector.Config.IdentityID)
+	}
+	proxy.Transport = f.transport
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get(forwardedHeader) != "" {
+			return errLeaderMoved
+		}
+		return nil
+	}
+	// 写入响应前失败时不写入, 由调用者重试
+	proxy.ErrorHandler = func(_ http.ResponseWriter, _ *http.Request, err error) {
+		failed = err
+	}
+	req := r.Clone(r.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	proxy.ServeHTTP(w, req)
+	return failed
+}
+
+// Leader 明确拒绝或连接失败时请求未被处理, 其他失败时请求可能已到达 Leader, 只重试幂等的请求
+func retryable(r *http.Request, err error) bool {
+	var op *net.OpError
+	if errors.Is(err, errLeaderMoved) || errors.As(err, &op) && op.Op == "dial" {
+		return true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != "" || r.Header.Get("X-Idempotency-Key") != ""
+}
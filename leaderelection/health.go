@@ -0,0 +1,134 @@
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ErrRenewalFailing = errors.New("leader renewal is failing")
+
+// Status 节点的选举状态
+type Status struct {
+	Identity string `json:"identity"`
+	IsLeader bool   `json:"is_leader"`
+	// 当选时的任期和最近一次成功续期的时间, 未当选时为零值
+	Term      int64     `json:"term"`
+	RenewedAt time.Time `json:"renewed_at"`
+	// 续期开始连续失败的时间, 续期正常时为零值
+	FailingSince time.Time `json:"failing_since"`
+	// 当前 Leader 的 Identity, 没有 Leader 时为空
+	Leader string `json:"leader"`
+	// 查询 Leader 失败的原因
+	Error string `json:"error,omitempty"`
+}
+
+// 记录当选期间的状态, record 为 nil 时表示已失去领导权
+func (t *term) track(record *LeaderRecord, err error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if record == nil {
+		t.record, t.failing = nil, time.Time{}
+		return
+	}
+	current := *record
+	t.record = &current
+	if err == nil {
+		t.failing = time.Time{}
+	} else if t.failing.IsZero() {
+		t.failing = time.Now()
+	}
+}
+
+func (t *term) status() (*LeaderRecord, time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.record, t.failing
+}
+
+func (e *Elector) currentTerm() *term {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.current
+}
+
+// Status 当前节点的选举状态, 当前 Leader 通过后端查询
+func (e *Elector) Status(ctx context.Context) Status {
+	status := Status{Identity: e.Config.IdentityID}
+	if t := e.currentTerm(); t != nil {
+		if record, failing := t.status(); record != nil {
+			status.IsLeader = true
+			status.Term, status.RenewedAt, status.FailingSince = record.Term, record.RenewedAt, failing
+		}
+	}
+	if record, err := e.Backend.Get(ctx, e.Name); err != nil {
+		status.Error = err.Error()
+	} else if record != nil {
+		status.Leader = record.Identity
+	}
+	return status
+}
+
+// Watchdog 当选期间续期连续失败超过 threshold 时返回 ErrRenewalFailing, 未当选或续期正常时返回 nil
+// 续期失败超过 RenewDeadline 后会失去领导权, threshold 应小于 RenewDeadline
+func (e *Elector) Watchdog(threshold time.Duration) error {
+	t := e.currentTerm()
+	if t == nil {
+		return nil
+	}
+	if record, failing := t.status(); record != nil && !failing.IsZero() && time.Since(failing) > threshold {
+		return fmt.Errorf("%w for %v", ErrRenewalFailing, time.Since(failing).Truncate(time.Millisecond))
+	}
+	return nil
+}
+
+type handler struct {
+	elector   *Elector
+	threshold time.Duration
+	leader    bool
+}
+
+type HandlerOption func(h *handler)
+
+// 续期连续失败超过 threshold 时返回 503, 默认为 RenewDeadline/2
+func WithUnhealthyThreshold(threshold time.Duration) HandlerOption {
+	return func(h *handler) {
+		h.threshold = threshold
+	}
+}
+
+// 未当选时返回 503, 用于只把流量转发给 Leader 的就绪探针
+func WithLeaderOnly() HandlerOption {
+	return func(h *handler) {
+		h.leader = true
+	}
+}
+
+// Handler 以 JSON 返回 Status, Watchdog 报告异常时返回 503
+func (e *Elector) Handler(opts ...HandlerOption) http.Handler {
+	h := &handler{elector: e}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	threshold := h.threshold
+	if threshold == 0 {
+		threshold = h.elector.Config.RenewDeadline / 2
+	}
+	status := h.elector.Status(r.Context())
+	code := http.StatusOK
+	if err := h.elector.Watchdog(threshold); err != nil {
+		status.Error, code = err.Error(), http.StatusServiceUnavailable
+	} else if h.leader && !status.IsLeader {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(&status)
+}
@@ -2,11 +2,12 @@ package leaderelection
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/J-guanghua/rwlock"
-	"github.com/J-guanghua/rwlock/db"
-	"github.com/J-guanghua/rwlock/redis"
+
 	"github.com/google/uuid"
 )
 
@@ -18,6 +19,14 @@ type LeaderElectionConfig struct { // nolint
 	OnNewLeader      func(identityID string)
 	OnStartedLeading func(ctx context.Context)
 	OnStoppedLeading func(identityID string)
+	// 对外提供服务的地址, 当选后写入记录, 供 ForwardHandler 转发请求
+	Endpoint string
+	// 优先级, 数值越大越优先, 需要 Registry 登记候选者
+	Priority int
+	// 优先级更高的候选者持续健康超过该时间后, 当前 Leader 让出并提名该候选者, 默认 30 秒
+	StabilizationPeriod time.Duration
+	// 登记存活的候选者, 为 nil 时不比较优先级, RedisRunOrDie 等默认使用与后端相同的存储
+	Registry Registry
 }
 
 func (lec *LeaderElectionConfig) Init() {
@@ -27,6 +36,9 @@ func (lec *LeaderElectionConfig) Init() {
 	if lec.RenewDeadline == 0 {
 		lec.RenewDeadline = 15 * time.Second
 	}
+	if lec.StabilizationPeriod == 0 {
+		lec.StabilizationPeriod = 30 * time.Second
+	}
 	if lec.OnNewLeader == nil {
 		lec.OnNewLeader = func(identityID string) {}
 	}
@@ -45,106 +57,103 @@ func (lec *LeaderElectionConfig) GetIdentityID() string {
 	return lec.IdentityID
 }
 
-// 自定义方案
-// Mutex Lock 需要支持可重入
-// Mutex 配置信息 选举IdentityID
-func RunOrDie(ctx context.Context, mutex rwlock.Mutex, configuration LeaderElectionConfig) { // nolint
+// 基于任意后端的选举, 当选后每隔 RenewDeadline/3 续期
+// 续期连续失败超过 RenewDeadline 或已被他人当选时失去领导权, 后端记录的过期时间为 RenewDeadline+2s
+// 自定义的 Mutex 通过 MutexBackend 适配, 后端实现 BlockingBackend 时阻塞等待当选
+func RunOrDie(ctx context.Context, backend ElectionBackend, name string, configuration LeaderElectionConfig) {
+	configuration.Init()
+	configuration.GetIdentityID()
+	defer candidate(ctx, name, configuration)()
+	runOrDie(ctx, backend, name, configuration, newTerm(true))
+}
+
+func runOrDie(ctx context.Context, backend ElectionBackend, name string, configuration LeaderElectionConfig, t *term) {
 	configuration.Init()
-	ctx2, cancel := context.WithCancel(ctx) // nolint
+	identity := configuration.GetIdentityID()
+	ttl := configuration.RenewDeadline + 2*time.Second
+	ctx = withEndpoint(ctx, configuration.Endpoint)
 LeaderElection:
-	ctx3, _ := context.WithTimeout(ctx, 200*time.Millisecond) // nolint
-	if err := mutex.Lock(ctx3); err != nil {
+	var record *LeaderRecord
+	var err error
+	if blocking, ok := backend.(BlockingBackend); ok {
+		record, err = blocking.Acquire(ctx, name, identity, ttl)
+	} else {
+		record, err = backend.TryAcquire(ctx, name, identity, ttl)
+	}
+	if err == nil && yields(ctx, backend, name, identity) {
+		// 其他节点被提名继任, 在提名窗口内让出
+		t.release(context.Background(), backend, name, record)
+		err = rwlock.ErrFailed
+	}
+	if err != nil {
 		select {
-		case <-ctx2.Done():
-			return // nolint
-		case <-time.After(configuration.RetryPeriod):
+		case <-ctx.Done():
+			return
+		case <-time.After(jitter(configuration.RetryPeriod)):
 			goto LeaderElection
 		}
 	}
 
 	// 当选 Leader
-	configuration.OnNewLeader(configuration.GetIdentityID())
-	go configuration.OnStartedLeading(ctx2)
-	for { // nolint
-		select { // nolint
-		case <-time.After(configuration.RenewDeadline):
-			if err := mutex.Lock(ctx2); err != nil {
-				cancel()
-				configuration.OnStoppedLeading(configuration.GetIdentityID())
-				return
+	ctx2, cancel := context.WithCancel(withRecord(ctx, record))
+	defer cancel()
+	configuration.OnNewLeader(identity)
+	// OnStartedLeading 中可以立即调用 Resign 和查询状态
+	atomic.StoreInt32(&t.elected, 1)
+	defer atomic.StoreInt32(&t.elected, 0)
+	t.track(record, nil)
+	defer t.track(nil, nil)
+	t.lead(ctx2, configuration.OnStartedLeading)
+	ticker := time.NewTicker(configuration.RenewDeadline / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			err = backend.Renew(ctx2, name, record, ttl)
+			t.track(record, err)
+			if err == nil {
+				renewed = time.Now()
+				if nominee := preferred(ctx2, backend, name, configuration); nominee != "" {
+					// 优先级更高的候选者已经稳定, 让出并提名
+					cancel()
+					_ = t.resignLeading(backend, name, record, configuration, &resignation{
+						nominee: nominee,
+						window:  2 * configuration.RetryPeriod,
+						drain:   configuration.RenewDeadline,
+					})
+					return
+				}
+				continue
+			} else if !errors.Is(err, ErrNotLeader) && time.Since(renewed) < configuration.RenewDeadline {
+				continue
 			}
-		case <-ctx2.Done():
-			configuration.OnStoppedLeading(configuration.GetIdentityID())
-			_ = mutex.Unlock(ctx2)
+		case <-ctx.Done():
+		case r := <-t.resign:
+			cancel()
+			r.done <- t.resignLeading(backend, name, record, configuration, r)
 			return
 		}
+		cancel()
+		configuration.OnStoppedLeading(identity)
+		t.release(ctx, backend, name, record)
+		return
 	}
 }
 
 // redis实现选举机制
 func RedisRunOrDie(ctx context.Context, name string, configuration LeaderElectionConfig) {
-	configuration.Init()
-	ctx2, cancel := context.WithCancel(ctx)
-	mutex := redis.Mutex(name, rwlock.WithTries(2),
-		rwlock.WithValue(configuration.GetIdentityID()),
-		rwlock.WithExpiry(configuration.RenewDeadline+2*time.Second),
-		rwlock.WithOnRenewal(func(renewal *rwlock.Renewal) {
-			if renewal.Err != nil || !renewal.Result {
-				defer cancel()
-				renewal.Cancel()
-			}
-		}),
-	)
-
-LeaderElection:
-	if err := mutex.Lock(ctx2); err != nil {
-		select {
-		case <-ctx2.Done():
-			return // nolint
-		case <-time.After(configuration.RetryPeriod):
-			goto LeaderElection
-		}
-	}
+	RunOrDie(ctx, RedisBackend(), name, withRegistry(configuration, RedisRegistry()))
+}
 
-	// 当选 Leader
-	defer cancel()
-	defer configuration.OnStoppedLeading(configuration.GetIdentityID())
-	configuration.OnNewLeader(configuration.GetIdentityID())
-	go configuration.OnStartedLeading(ctx2)
-	<-ctx2.Done()
-	_ = mutex.Unlock(ctx2)
+// 文件锁实现选举机制, 适用于同一主机上的多个进程
+// 等待者阻塞在 flock 上, Leader 进程退出时内核释放锁, 等待者立即当选
+func FileRunOrDie(ctx context.Context, name string, configuration LeaderElectionConfig) {
+	RunOrDie(ctx, FileBackend(), name, withRegistry(configuration, FileRegistry()))
 }
 
 // mysql实现选举机制
+// GET_LOCK 之外保存 Leader 记录, 续期确认锁仍由当前会话持有, MysqlObserver 可以查询当前的 Leader
 func MysqlRunOrDie(ctx context.Context, name string, configuration LeaderElectionConfig) {
-	configuration.Init()
-	ctx2, cancel := context.WithCancel(ctx)
-	defer cancel()
-	mutex := db.Mutex(name, rwlock.WithTries(2))
-LeaderElection:
-	if err := mutex.Lock(ctx2); err != nil {
-		select {
-		case <-ctx2.Done():
-			return // nolint
-		case <-time.After(configuration.RetryPeriod):
-			goto LeaderElection
-		}
-	}
-
-	// 当选 Leader
-	configuration.OnNewLeader(configuration.GetIdentityID())
-	go configuration.OnStartedLeading(ctx2)
-	for { // nolint
-		select { // nolint
-		case <-time.After(configuration.RenewDeadline):
-			if err := mutex.Lock(ctx2); err != nil {
-				configuration.OnStoppedLeading(configuration.GetIdentityID())
-				return
-			}
-		case <-ctx2.Done():
-			configuration.OnStoppedLeading(configuration.GetIdentityID())
-			_ = mutex.Unlock(ctx2)
-			return
-		}
-	}
+	RunOrDie(ctx, MysqlBackend(), name, withRegistry(configuration, MysqlRegistry()))
 }
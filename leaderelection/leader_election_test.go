@@ -3,11 +3,24 @@ package leaderelection
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/J-guanghua/rwlock"
 	"github.com/J-guanghua/rwlock/db"
+	"github.com/J-guanghua/rwlock/file"
 	rwredis "github.com/J-guanghua/rwlock/redis"
 	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
@@ -40,6 +53,38 @@ func TestMysqlElectionRunOrDie(_ *testing.T) {
 	})
 }
 
+func TestMysqlBackend(t *testing.T) {
+	db2, err := sql.Open("mysql", "root:guanghua@tcp(192.168.43.152:3306)/sys?parseTime=true")
+	if err != nil {
+		panic(err)
+	}
+	db.Init(db2)
+	ctx := context.TODO()
+	backend := MysqlBackend()
+	record, err := backend.TryAcquire(withEndpoint(ctx, "http://node-1"), "mysql-backend", "node-1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader, err := MysqlObserver().GetLeader(ctx, "mysql-backend")
+	if err != nil || leader == nil || leader.Identity != "node-1" || leader.Term != record.Term || leader.Endpoint != "http://node-1" {
+		t.Fatalf("观察者查询到的 Leader 错误: %+v, %v", leader, err)
+	}
+	if err = backend.Renew(ctx, "mysql-backend", record, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	stale := *record
+	stale.Term--
+	if err = backend.Release(ctx, "mysql-backend", &stale); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("旧任期释放应返回 ErrNotLeader, 实际 %v", err)
+	}
+	if err = backend.Release(ctx, "mysql-backend", record); err != nil {
+		t.Fatal(err)
+	}
+	if leader, err = backend.Get(ctx, "mysql-backend"); err != nil || leader != nil {
+		t.Fatalf("释放后不应有 Leader: %+v, %v", leader, err)
+	}
+}
+
 func TestRedisElectionRunOrDie(_ *testing.T) {
 	rwredis.Init(&redis.Options{
 		Addr:         "192.168.43.152:6379",
@@ -71,3 +116,803 @@ func TestRedisElectionRunOrDie(_ *testing.T) {
 		},
 	})
 }
+
+func TestFileObserver(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	observer := FileObserver()
+	observer.Interval = 10 * time.Millisecond
+	watch := observer.WatchLeader(ctx, "observer")
+	if record := <-watch; record.Identity != "" {
+		t.Fatalf("不应有 Leader: %+v", record)
+	}
+
+	backend := FileBackend()
+	for term := int64(1); term <= 2; term++ {
+		elected, err := backend.TryAcquire(ctx, "observer", "node-1", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := observer.GetLeader(ctx, "observer")
+		if err != nil || record == nil || record.Identity != "node-1" || record.Term != term {
+			t.Fatalf("Leader 记录错误: %+v, %v", record, err)
+		}
+		if record := <-watch; record.Identity != "node-1" || record.Term != term {
+			t.Fatalf("未通知新的 Leader: %+v", record)
+		}
+		if err = backend.Release(ctx, "observer", elected); err != nil {
+			t.Fatal(err)
+		}
+		if record := <-watch; record.Identity != "" {
+			t.Fatalf("释放后不应有 Leader: %+v", record)
+		}
+	}
+}
+
+func TestFileBackendTerm(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	ctx := context.TODO()
+	backend := FileBackend()
+	old, err := backend.TryAcquire(ctx, "term", "node-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.Renew(ctx, "term", old, 0); err != nil || old.RenewedAt.Before(old.AcquiredAt) {
+		t.Fatalf("续期失败: %+v, %v", old, err)
+	}
+	if _, err = FileBackend().TryAcquire(ctx, "term", "node-2", 0); !errors.Is(err, rwlock.ErrFailed) {
+		t.Fatalf("已有 Leader 时应返回 ErrFailed, 实际 %v", err)
+	}
+	if err = backend.Release(ctx, "term", old); err != nil {
+		t.Fatal(err)
+	}
+	record, err := backend.TryAcquire(ctx, "term", "node-2", 0)
+	if err != nil || record.Term != old.Term+1 {
+		t.Fatalf("任期未递增: %+v, %v", record, err)
+	}
+	defer backend.Release(ctx, "term", record) // nolint
+	if err = backend.Renew(ctx, "term", old, 0); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("旧任期续期应返回 ErrNotLeader, 实际 %v", err)
+	}
+	if term := TermFromContext(withRecord(ctx, record)); term != record.Term {
+		t.Fatalf("context 中的任期错误: %v", term)
+	}
+}
+
+// 进程内的 Mutex
+type chanMutex chan struct{}
+
+func (m chanMutex) Lock(ctx context.Context) error {
+	select {
+	case m <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m chanMutex) Unlock(_ context.Context) error {
+	<-m
+	return nil
+}
+
+func lockerOf(mutex rwlock.Mutex) Locker {
+	return func(string, ...rwlock.Option) rwlock.Mutex {
+		return mutex
+	}
+}
+
+// 记录加锁的上下文和选项, 模拟 Mutex 的续期
+type renewalMutex struct {
+	chanMutex
+	ctx  context.Context
+	opts *rwlock.Options
+}
+
+func (m *renewalMutex) Lock(ctx context.Context) error {
+	m.ctx = ctx
+	return m.chanMutex.Lock(ctx)
+}
+
+// 加锁的上下文持续整个任期, 续期失败后 Renew 返回 ErrNotLeader
+func TestMutexBackendRenewal(t *testing.T) {
+	mutex := &renewalMutex{chanMutex: make(chanMutex, 1)}
+	backend := MutexBackend(func(_ string, opts ...rwlock.Option) rwlock.Mutex {
+		mutex.opts = &rwlock.Options{}
+		for _, o := range opts {
+			o(mutex.opts)
+		}
+		return mutex
+	})
+	ctx := context.Background()
+	record, err := backend.TryAcquire(ctx, "renewal", "node-1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mutex.ctx.Err() != nil {
+		t.Fatal("当选后加锁的上下文不应结束")
+	}
+	if err = backend.Renew(ctx, "renewal", record, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	mutex.opts.OnRenewal(&rwlock.Renewal{Ctx: mutex.ctx, Name: "renewal"})
+	if err = backend.Renew(ctx, "renewal", record, time.Second); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("锁丢失后应返回 ErrNotLeader: %v", err)
+	}
+	if err = backend.Release(ctx, "renewal", record); err != nil {
+		t.Fatal(err)
+	}
+	if mutex.ctx.Err() == nil {
+		t.Fatal("释放后加锁的上下文应结束")
+	}
+	if record, err = backend.TryAcquire(ctx, "renewal", "node-1", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.Renew(ctx, "renewal", record, time.Second); err != nil {
+		t.Fatalf("新任期不应受上一任期影响: %v", err)
+	}
+}
+
+func TestMutexBackendNames(t *testing.T) {
+	mutexes := map[string]chanMutex{"a": make(chanMutex, 1), "b": make(chanMutex, 1)}
+	backend := MutexBackend(func(name string, _ ...rwlock.Option) rwlock.Mutex {
+		return mutexes[name]
+	})
+	ctx := context.Background()
+	a, err := backend.TryAcquire(ctx, "a", "node-1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := backend.TryAcquire(ctx, "b", "node-1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.Renew(ctx, "a", a, time.Second); err != nil {
+		t.Fatalf("其他名称当选不应影响续期: %v", err)
+	}
+	if record, _ := backend.Get(ctx, "a"); record == nil || record.Term != a.Term {
+		t.Fatalf("记录应按名称保存: %+v", record)
+	}
+	if err = backend.Release(ctx, "a", a); err != nil {
+		t.Fatal(err)
+	}
+	if len(mutexes["a"]) != 0 {
+		t.Fatal("释放后锁 a 应被解锁")
+	}
+	if err = backend.Renew(ctx, "b", b, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.Release(ctx, "b", b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 每 3 次续期失败一次, 模拟失去领导权
+type flakyBackend struct {
+	mutexBackend
+	renews int32
+}
+
+func (b *flakyBackend) Renew(ctx context.Context, name string, record *LeaderRecord, ttl time.Duration) error {
+	if atomic.AddInt32(&b.renews, 1)%3 == 0 {
+		return ErrNotLeader
+	}
+	return b.mutexBackend.Renew(ctx, name, record, ttl)
+}
+
+func TestElectorRun(t *testing.T) {
+	var terms, leading int32
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	backend := &flakyBackend{mutexBackend: mutexBackend{locker: lockerOf(make(chanMutex, 1))}}
+	elector := NewElector(backend, "flaky", LeaderElectionConfig{
+		RetryPeriod:   10 * time.Millisecond,
+		RenewDeadline: 30 * time.Millisecond,
+		OnNewLeader: func(identityID string) {
+			if atomic.LoadInt32(&leading) != 0 {
+				t.Errorf("上一任期的 OnStartedLeading 尚未返回")
+			}
+			atomic.AddInt32(&terms, 1)
+		},
+		OnStartedLeading: func(ctx context.Context) {
+			atomic.StoreInt32(&leading, 1)
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			atomic.StoreInt32(&leading, 0)
+		},
+	})
+	elector.Run(ctx)
+	if n := atomic.LoadInt32(&terms); n < 2 {
+		t.Fatalf("失去领导权后应重新当选, 当选 %d 次", n)
+	}
+	if atomic.LoadInt32(&leading) != 0 {
+		t.Fatal("Run 返回时 OnStartedLeading 应已返回")
+	}
+}
+
+// 不可重入的 Mutex 也可以正常续期, ctx 结束后释放
+func TestRunOrDieMutex(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	mutex := file.Mutex("run-or-die")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var leading int32
+	RunOrDie(ctx, MutexBackend(file.Mutex), "run-or-die", LeaderElectionConfig{
+		RenewDeadline: 30 * time.Millisecond,
+		OnStartedLeading: func(ctx context.Context) {
+			atomic.StoreInt32(&leading, 1)
+		},
+	})
+	if atomic.LoadInt32(&leading) != 1 {
+		t.Fatal("应当选 Leader")
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := mutex.Lock(ctx); err != nil {
+		t.Fatalf("结束后应已释放锁: %v", err)
+	}
+	_ = mutex.Unlock(ctx)
+}
+
+// 持有锁的进程退出后立即当选, 不需要等待 RetryPeriod
+func TestFileRunOrDie(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	path, err := file.Path("file-election", ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader := exec.Command("flock", path, "sleep", "0.3")
+	if err = leader.Start(); err != nil {
+		t.Skip(err)
+	}
+	exited := make(chan time.Time, 1)
+	go func() {
+		_ = leader.Wait()
+		exited <- time.Now()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	elected := make(chan time.Time, 1)
+	done := make(chan struct{})
+	defer func() { <-done }()
+	defer cancel()
+	go func() {
+		defer close(done)
+		FileRunOrDie(ctx, "file-election", LeaderElectionConfig{
+			RetryPeriod: 10 * time.Second,
+			OnNewLeader: func(identityID string) {
+				elected <- time.Now()
+			},
+		})
+	}()
+	select {
+	case at := <-elected:
+		if exit := <-exited; at.Sub(exit) > time.Second {
+			t.Fatalf("Leader 退出 %v 后才当选", at.Sub(exit))
+		}
+	case <-ctx.Done():
+		t.Fatal("Leader 退出后未当选")
+	}
+	record, err := FileObserver().GetLeader(ctx, "file-election")
+	if err != nil || record == nil || record.Term != 1 {
+		t.Fatalf("Leader 记录错误: %+v, %v", record, err)
+	}
+}
+
+func TestElectorResign(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	backend := MutexBackend(lockerOf(make(chanMutex, 1)))
+	leaders := make(chan string, 10)
+	var drained int32
+	electors := map[string]*Elector{}
+	var wg sync.WaitGroup
+	for _, identity := range []string{"node-a", "node-b", "node-c"} {
+		elector := NewElector(backend, "resign", LeaderElectionConfig{
+			IdentityID:    identity,
+			RetryPeriod:   10 * time.Millisecond,
+			RenewDeadline: time.Second,
+			OnNewLeader: func(identityID string) {
+				leaders <- identityID
+			},
+			OnStartedLeading: func(ctx context.Context) {
+				<-ctx.Done()
+				time.Sleep(20 * time.Millisecond)
+				atomic.StoreInt32(&drained, 1)
+			},
+		})
+		electors[identity] = elector
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			elector.Run(ctx)
+		}()
+		if identity == "node-a" {
+			if leader := <-leaders; leader != "node-a" {
+				t.Fatalf("期望 node-a 当选, 实际 %v", leader)
+			}
+		}
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	if err := electors["node-b"].Resign(ctx); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("未当选时应返回 ErrNotLeader, 实际 %v", err)
+	}
+	err := electors["node-a"].Resign(ctx, WithNominee("node-c"), WithNominationWindow(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	} else if atomic.LoadInt32(&drained) != 1 {
+		t.Fatal("Resign 返回前 OnStartedLeading 应已返回")
+	}
+	if leader := <-leaders; leader != "node-c" {
+		t.Fatalf("期望被提名的 node-c 当选, 实际 %v", leader)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	shards := make([]string, 10)
+	for i := range shards {
+		shards[i] = strconv.Itoa(i)
+	}
+	owners := assign(shards, []string{"a", "b", "c"})
+	load := map[string]int{}
+	for _, owner := range owners {
+		load[owner]++
+	}
+	if len(owners) != len(shards) || load["a"] > 4 || load["b"] > 4 || load["c"] > 4 {
+		t.Fatalf("分配不均衡: %v", load)
+	}
+	if reordered := assign(shards, []string{"c", "a", "b"}); !reflect.DeepEqual(owners, reordered) {
+		t.Fatalf("成员顺序不应影响分配: %v, %v", owners, reordered)
+	}
+}
+
+func TestFileShardManager(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	shards := []string{"0", "1", "2", "3", "4", "5", "6", "7"}
+	var mtx sync.Mutex
+	owners := map[string]string{}
+	newManager := func(identity string) *ShardManager {
+		return NewFileShardManager("shards", ShardConfig{
+			IdentityID:    identity,
+			Shards:        shards,
+			RenewDeadline: 90 * time.Millisecond,
+			OnAssigned: func(ctx context.Context, shard string) {
+				mtx.Lock()
+				if owner, ok := owners[shard]; ok {
+					t.Errorf("分片 %s 同时被 %s 和 %s 持有", shard, owner, identity)
+				}
+				owners[shard] = identity
+				mtx.Unlock()
+				// 持有期间阻塞不应影响续期
+				<-ctx.Done()
+			},
+			OnRevoked: func(shard string) {
+				mtx.Lock()
+				defer mtx.Unlock()
+				delete(owners, shard)
+			},
+		})
+	}
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("等待重新平衡超时")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	run := func(m *ShardManager) (context.CancelFunc, chan struct{}) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			m.Run(ctx)
+		}()
+		return cancel, done
+	}
+
+	a, b := newManager("a"), newManager("b")
+	cancelA, doneA := run(a)
+	defer func() { cancelA(); <-doneA }()
+	waitFor(func() bool { return len(a.Assigned()) == len(shards) })
+
+	cancelB, doneB := run(b)
+	waitFor(func() bool { return len(a.Assigned()) == 4 && len(b.Assigned()) == 4 })
+
+	cancelB()
+	<-doneB
+	waitFor(func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, shard := range shards {
+			if owners[shard] != "a" {
+				return false
+			}
+		}
+		return len(a.Assigned()) == len(shards)
+	})
+	// 回调一直阻塞, 经过数个续期期限后仍持有全部分片
+	time.Sleep(300 * time.Millisecond)
+	if assigned := a.Assigned(); len(assigned) != len(shards) {
+		t.Fatalf("回调阻塞时不应失去分片: %v", assigned)
+	}
+}
+
+func TestElectorPriority(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	leaders := make(chan string, 10)
+	backend := MutexBackend(lockerOf(make(chanMutex, 1)))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	for _, identity := range []string{"standby", "primary"} {
+		priority := 0
+		if identity == "primary" {
+			priority = 1
+		}
+		elector := NewElector(backend, "priority", LeaderElectionConfig{
+			IdentityID:          identity,
+			Priority:            priority,
+			StabilizationPeriod: 200 * time.Millisecond,
+			Registry:            FileRegistry(),
+			RetryPeriod:         10 * time.Millisecond,
+			RenewDeadline:       60 * time.Millisecond,
+			OnNewLeader: func(identityID string) {
+				leaders <- identityID
+			},
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			elector.Run(ctx)
+		}()
+		if identity == "standby" {
+			if leader := <-leaders; leader != "standby" {
+				t.Fatalf("期望 standby 当选, 实际 %v", leader)
+			}
+		}
+	}
+	start := time.Now()
+	if leader := <-leaders; leader != "primary" {
+		t.Fatalf("期望优先级更高的 primary 当选, 实际 %v", leader)
+	} else if time.Since(start) < 200*time.Millisecond {
+		t.Fatal("primary 未经过稳定期就已当选")
+	}
+	select {
+	case leader := <-leaders:
+		t.Fatalf("primary 健康时 %v 不应当选", leader)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestFileRegistryRejoin(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	ctx := context.Background()
+	registry := FileRegistry()
+	joinedAt := func() time.Time {
+		members, err := registry.Members(ctx, "rejoin")
+		if err != nil || len(members) != 1 {
+			t.Fatalf("期望一个候选者: %v %v", members, err)
+		}
+		return members[0].JoinedAt
+	}
+	member := Member{Identity: "node-1", JoinedAt: time.Now().Add(-time.Hour)}
+	if err := registry.Heartbeat(ctx, "rejoin", member, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	joined := joinedAt()
+	if time.Since(joined) > time.Second {
+		t.Fatal("加入时间应由 Registry 设置")
+	}
+	_ = registry.Heartbeat(ctx, "rejoin", member, 100*time.Millisecond)
+	if !joinedAt().Equal(joined) {
+		t.Fatal("存活期间应保留加入时间")
+	}
+	time.Sleep(150 * time.Millisecond)
+	_ = registry.Heartbeat(ctx, "rejoin", member, 100*time.Millisecond)
+	if !joinedAt().After(joined) {
+		t.Fatal("过期后重新加入应更新加入时间")
+	}
+}
+
+func TestPreferredNominator(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	ctx := context.Background()
+	configuration := LeaderElectionConfig{IdentityID: "standby", Registry: FileRegistry()}
+	_ = configuration.Registry.Heartbeat(ctx, "preferred", Member{Identity: "primary", Priority: 1}, time.Second)
+	backend := MutexBackend(lockerOf(make(chanMutex, 1)))
+	if nominee := preferred(ctx, backend, "preferred", configuration); nominee != "primary" {
+		t.Fatalf("期望让出给 primary, 实际 %q", nominee)
+	}
+	// 只暴露 ElectionBackend 的方法, 不支持提名
+	plain := struct{ ElectionBackend }{backend}
+	if nominee := preferred(ctx, plain, "preferred", configuration); nominee != "" {
+		t.Fatalf("后端不支持提名时不应让出: %q", nominee)
+	}
+}
+
+// 置位后续期返回网络错误, 但在 RenewDeadline 内不会失去领导权
+type unreachableBackend struct {
+	mutexBackend
+	down int32
+}
+
+func (b *unreachableBackend) Renew(ctx context.Context, name string, record *LeaderRecord, ttl time.Duration) error {
+	if atomic.LoadInt32(&b.down) == 1 {
+		return errors.New("unreachable")
+	}
+	return b.mutexBackend.Renew(ctx, name, record, ttl)
+}
+
+func TestElectorHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	backend := &unreachableBackend{mutexBackend: mutexBackend{locker: lockerOf(make(chanMutex, 1))}}
+	elected := make(chan struct{})
+	elector := NewElector(backend, "health", LeaderElectionConfig{
+		IdentityID:    "node-1",
+		RenewDeadline: 3 * time.Second,
+		OnNewLeader: func(identityID string) {
+			close(elected)
+		},
+	})
+	handler := elector.Handler(WithLeaderOnly(), WithUnhealthyThreshold(200*time.Millisecond))
+	get := func() (int, Status) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/leader", nil))
+		status := Status{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Code, status
+	}
+	if code, status := get(); code != http.StatusServiceUnavailable || status.IsLeader || status.Identity != "node-1" {
+		t.Fatalf("未当选时状态错误: %v, %+v", code, status)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		elector.Run(ctx)
+	}()
+	defer func() { <-done }()
+	defer cancel()
+	<-elected
+	if code, status := get(); code != http.StatusOK || !status.IsLeader || status.Leader != "node-1" || status.Term != 1 {
+		t.Fatalf("当选后状态错误: %v, %+v", code, status)
+	}
+
+	atomic.StoreInt32(&backend.down, 1)
+	deadline := time.Now().Add(3 * time.Second)
+	for elector.Watchdog(200*time.Millisecond) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("续期失败后 Watchdog 未报告异常")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	code, status := get()
+	if code != http.StatusServiceUnavailable || !status.IsLeader || status.FailingSince.IsZero() {
+		t.Fatalf("续期失败时状态错误: %v, %+v", code, status)
+	}
+	if err := elector.Watchdog(200 * time.Millisecond); !errors.Is(err, ErrRenewalFailing) {
+		t.Fatalf("期望 ErrRenewalFailing, 实际 %v", err)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := make(chan string, 20)
+	runner := NewRunner(NewElector(MutexBackend(lockerOf(make(chanMutex, 1))), "runner", LeaderElectionConfig{
+		RetryPeriod:   time.Second,
+		RenewDeadline: time.Second,
+	}))
+	runner.ResignOnCrash = true
+	runner.OnCrash = func(name string, err error) {
+		events <- "crash:" + name
+	}
+	for _, name := range []string{"a", "b"} {
+		name := name
+		runner.Register(name, ServiceFunc(func(ctx context.Context) error {
+			if TermFromContext(ctx) != 1 {
+				t.Errorf("服务 %s 的 ctx 中没有任期", name)
+			}
+			events <- "start:" + name
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			events <- "stop:" + name
+			return nil
+		}))
+	}
+	runner.Register("crash", ServiceFunc(func(ctx context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		return errors.New("crashed")
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner.Run(ctx)
+	}()
+	defer func() { <-done }()
+	defer cancel()
+
+	var got []string
+	for len(got) < 5 {
+		select {
+		case e := <-events:
+			got = append(got, e)
+		case <-ctx.Done():
+			t.Fatalf("事件不完整: %v", got)
+		}
+	}
+	// a 和 b 的启动顺序不确定
+	if got[2] != "crash:crash" || got[3] != "stop:b" || got[4] != "stop:a" {
+		t.Fatalf("服务应按相反顺序停止: %v", got)
+	}
+	if err := runner.Elector.Resign(ctx); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("服务崩溃后应已放弃领导权, 实际 %v", err)
+	}
+}
+
+// OnStartedLeading 开始时已处于当选状态, 可以立即放弃领导权
+func TestResignOnStart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resigned := make(chan error, 1)
+	var elector *Elector
+	elector = NewElector(MutexBackend(lockerOf(make(chanMutex, 1))), "resign-on-start", LeaderElectionConfig{
+		RetryPeriod:   time.Second,
+		RenewDeadline: time.Second,
+		OnStartedLeading: func(ctx context.Context) {
+			go func() { resigned <- elector.Resign(context.Background()) }()
+			<-ctx.Done()
+		},
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		elector.Run(ctx)
+	}()
+	defer func() { <-done }()
+	defer cancel()
+	select {
+	case err := <-resigned:
+		if err != nil {
+			t.Fatalf("当选后应能立即放弃领导权: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("未当选")
+	}
+}
+
+func TestForwardHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	backend := MutexBackend(lockerOf(make(chanMutex, 1)))
+	leaders := make(chan string, 10)
+	electors := map[string]*Elector{}
+	servers := map[string]*httptest.Server{}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	for _, identity := range []string{"node-a", "node-b"} {
+		identity := identity
+		var handler atomic.Value
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.Load().(http.Handler).ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		elector := NewElector(backend, "forward", LeaderElectionConfig{
+			IdentityID:    identity,
+			Endpoint:      server.URL,
+			RetryPeriod:   10 * time.Millisecond,
+			RenewDeadline: time.Second,
+			OnNewLeader: func(identityID string) {
+				leaders <- identityID
+			},
+		})
+		handler.Store(elector.ForwardHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			_, _ = w.Write([]byte(identity + ":" + string(body)))
+		})))
+		electors[identity], servers[identity] = elector, server
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			elector.Run(ctx)
+		}()
+		if identity == "node-a" {
+			<-leaders
+		}
+	}
+	post := func(identity string, header http.Header) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, servers[identity].URL+"/jobs", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, body := post("node-b", nil); code != http.StatusOK || body != "node-a:payload" {
+		t.Fatalf("Follower 应转发给 Leader: %v, %v", code, body)
+	}
+	if record, _ := RecordFromContext(withRecord(ctx, mustGet(t, backend))); record.Endpoint != servers["node-a"].URL {
+		t.Fatalf("记录中的 Endpoint 错误: %+v", record)
+	}
+
+	if err := electors["node-a"].Resign(ctx, WithNominee("node-b")); err != nil {
+		t.Fatal(err)
+	}
+	if leader := <-leaders; leader != "node-b" {
+		t.Fatalf("期望 node-b 当选, 实际 %v", leader)
+	}
+	if code, body := post("node-a", nil); code != http.StatusOK || body != "node-b:payload" {
+		t.Fatalf("领导权变化后应转发给新的 Leader: %v, %v", code, body)
+	}
+	code, _ := post("node-a", http.Header{forwardedHeader: []string{"node-c"}})
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("已转发的请求不应再次转发: %v", code)
+	}
+
+	// 请求已发出后失败, 非幂等的请求不重试
+	var sent int32
+	handler := electors["node-a"].ForwardHandler(http.NotFoundHandler(),
+		WithForwardMaxBody(16),
+		WithForwardTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+			atomic.AddInt32(&sent, 1)
+			return nil, io.ErrUnexpectedEOF
+		})))
+	serve := func(method, body string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/jobs", strings.NewReader(body)))
+		return w.Code
+	}
+	if code := serve(http.MethodPost, "payload"); code != http.StatusBadGateway || atomic.LoadInt32(&sent) != 1 {
+		t.Fatalf("非幂等的请求不应重试: %v, %d", code, sent)
+	}
+	if code := serve(http.MethodGet, ""); code != http.StatusServiceUnavailable || atomic.LoadInt32(&sent) != 5 {
+		t.Fatalf("幂等的请求应重试: %v, %d", code, sent)
+	}
+	if code := serve(http.MethodPost, strings.Repeat("x", 32)); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("请求体超过上限应返回 413: %v", code)
+	}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func mustGet(t *testing.T, backend ElectionBackend) *LeaderRecord {
+	record, err := backend.Get(context.Background(), "forward")
+	if err != nil || record == nil {
+		t.Fatalf("查询 Leader 失败: %+v, %v", record, err)
+	}
+	return record
+}
@@ -0,0 +1,71 @@
+package leaderelection
+
+import (
+	"context"
+	"time"
+)
+
+// 未指定 Registry 时使用与后端相同存储的 Registry
+func withRegistry(configuration LeaderElectionConfig, registry Registry) LeaderElectionConfig {
+	if configuration.Registry == nil {
+		configuration.Registry = registry
+	}
+	return configuration
+}
+
+// 在 Registry 中登记为候选者, 每隔 RenewDeadline/3 心跳直到返回的函数被调用, 之后离开
+// configuration 需要已经 Init 并确定 IdentityID
+func candidate(ctx context.Context, name string, configuration LeaderElectionConfig) func() {
+	if configuration.Registry == nil {
+		return func() {}
+	}
+	// 加入时间由 Registry 在加入或过期后重新加入时设置
+	member := Member{
+		Identity: configuration.IdentityID,
+		Priority: configuration.Priority,
+	}
+	ttl := configuration.RenewDeadline + 2*time.Second
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(configuration.RenewDeadline / 3)
+		defer ticker.Stop()
+		for {
+			_ = configuration.Registry.Heartbeat(ctx, name, member, ttl)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		defer cancel()
+		_ = configuration.Registry.Leave(ctx, name, member.Identity)
+	}
+}
+
+// 持续健康超过 StabilizationPeriod 且优先级最高的其他候选者, 优先级都不高于自己时返回空字符串
+// 该候选者需要能够访问选举后端, 否则 Leader 会反复让出
+// 后端不支持提名时无法保证由该候选者接任, 不让出
+func preferred(ctx context.Context, backend ElectionBackend, name string, configuration LeaderElectionConfig) string {
+	if _, ok := backend.(Nominator); !ok || configuration.Registry == nil {
+		return ""
+	}
+	members, err := configuration.Registry.Members(ctx, name)
+	if err != nil {
+		return ""
+	}
+	nominee, priority := "", configuration.Priority
+	for _, member := range members {
+		if member.Identity != configuration.IdentityID && member.Priority > priority &&
+			time.Since(member.JoinedAt) >= configuration.StabilizationPeriod {
+			nominee, priority = member.Identity, member.Priority
+		}
+	}
+	return nominee
+}
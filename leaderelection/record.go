@@ -0,0 +1,145 @@
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotLeader = errors.New("leader record belongs to another term")
+
+// 未设置 Observer.Interval 时查询 Leader 记录的间隔
+const watchInterval = time.Second
+
+// LeaderRecord 当前 Leader 的信息, 由当选的进程写入
+type LeaderRecord struct {
+	Identity   string    `json:"identity"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	// 每次当选递增, 不会重复
+	Term      int64     `json:"term"`
+	RenewedAt time.Time `json:"renewed_at"`
+	// Leader 对外提供服务的地址, 用于将请求转发给 Leader
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+type recordKey struct{}
+
+type endpointKey struct{}
+
+// RecordFromContext 在 OnStartedLeading 中获取本次当选的记录
+func RecordFromContext(ctx context.Context) (LeaderRecord, bool) {
+	record, ok := ctx.Value(recordKey{}).(LeaderRecord)
+	return record, ok
+}
+
+// TermFromContext 在 OnStartedLeading 中获取本次当选的任期, 没有记录时返回 0
+// 业务数据记录写入时的任期, 只接受不小于已记录任期的写入, 即可拒绝旧 Leader 的写入
+func TermFromContext(ctx context.Context) int64 {
+	record, _ := RecordFromContext(ctx)
+	return record.Term
+}
+
+// 保存当选时的副本, 续期会修改 record
+func withRecord(ctx context.Context, record *LeaderRecord) context.Context {
+	return context.WithValue(ctx, recordKey{}, *record)
+}
+
+// EndpointFromContext 在 TryAcquire 中获取候选者的 Endpoint, 后端将其写入记录
+func EndpointFromContext(ctx context.Context) string {
+	endpoint, _ := ctx.Value(endpointKey{}).(string)
+	return endpoint
+}
+
+func withEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// ElectionBackend 选举使用的存储, 由 redis、mysql、文件等后端实现, 也可以自定义
+// 所有方法都不应阻塞等待其他节点
+type ElectionBackend interface {
+	// 尝试当选, 已有 Leader 时返回 rwlock.ErrFailed
+	// 当选后写入记录, 任期在上一任期的基础上加一, 记录在 ttl 内未续期时视为没有 Leader
+	// 记录的 Endpoint 通过 EndpointFromContext 获取
+	TryAcquire(ctx context.Context, name, identity string, ttl time.Duration) (*LeaderRecord, error)
+	// 续期并更新续期时间, 已失去领导权时返回 ErrNotLeader
+	Renew(ctx context.Context, name string, record *LeaderRecord, ttl time.Duration) error
+	// 主动放弃领导权, 其他节点可以立即当选
+	Release(ctx context.Context, name string, record *LeaderRecord) error
+	// 当前的 Leader, 没有时返回 nil
+	Get(ctx context.Context, name string) (*LeaderRecord, error)
+}
+
+// BlockingBackend 支持阻塞等待当选的后端, Leader 释放或退出后立即当选, 不需要等待 RetryPeriod
+type BlockingBackend interface {
+	ElectionBackend
+	// 阻塞直到当选或 ctx 结束
+	Acquire(ctx context.Context, name, identity string, ttl time.Duration) (*LeaderRecord, error)
+}
+
+// Observer 不参与选举, 查询或监听当前的 Leader
+type Observer struct {
+	Backend ElectionBackend
+	// WatchLeader 查询记录的间隔, 默认 1 秒
+	Interval time.Duration
+}
+
+func NewObserver(backend ElectionBackend) *Observer {
+	return &Observer{Backend: backend, Interval: watchInterval}
+}
+
+// 查询 redis 选举 RedisRunOrDie 的 Leader
+func RedisObserver() *Observer {
+	return NewObserver(RedisBackend())
+}
+
+// 查询 mysql 选举 MysqlRunOrDie 的 Leader
+func MysqlObserver() *Observer {
+	return NewObserver(MysqlBackend())
+}
+
+// 查询本机文件锁选举 FileRunOrDie 的 Leader
+func FileObserver() *Observer {
+	return NewObserver(FileBackend())
+}
+
+// GetLeader 当前的 Leader, 没有时返回 nil
+func (o *Observer) GetLeader(ctx context.Context, name string) (*LeaderRecord, error) {
+	return o.Backend.Get(ctx, name)
+}
+
+// WatchLeader 先发送当前的 Leader, 之后在 Leader 或任期变化时发送新的记录
+// 没有 Leader 时发送零值, 查询出错时保持上一次的结果, ctx 结束后关闭
+func (o *Observer) WatchLeader(ctx context.Context, name string) <-chan LeaderRecord {
+	ch := make(chan LeaderRecord, 1)
+	interval := o.Interval
+	if interval <= 0 {
+		interval = watchInterval
+	}
+	go func() {
+		defer close(ch)
+		var last *LeaderRecord
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if record, err := o.Backend.Get(ctx, name); err == nil {
+				if record == nil {
+					record = &LeaderRecord{}
+				}
+				if last == nil || last.Identity != record.Identity || last.Term != record.Term {
+					last = record
+					select {
+					case ch <- *record:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return ch
+}
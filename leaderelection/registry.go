@@ -0,0 +1,25 @@
+package leaderelection
+
+import (
+	"context"
+	"time"
+)
+
+// Member 一个存活的候选者
+type Member struct {
+	Identity string `json:"identity"`
+	// 数值越大越优先
+	Priority int `json:"priority"`
+	// 本次加入的时间, 由 Registry 在加入或过期后重新加入时设置, Heartbeat 忽略传入的值
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Registry 通过心跳记录一组存活的候选者, 由各后端实现
+type Registry interface {
+	// 加入或续期, ttl 内未续期视为离开
+	Heartbeat(ctx context.Context, group string, member Member, ttl time.Duration) error
+	// 主动离开
+	Leave(ctx context.Context, group, identity string) error
+	// 存活的候选者, 按 Identity 排序
+	Members(ctx context.Context, group string) ([]Member, error)
+}
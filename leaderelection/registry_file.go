@@ -0,0 +1,98 @@
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/J-guanghua/rwlock/file"
+)
+
+// 候选者及其过期时间, 同一主机上的进程共用时钟
+type registration struct {
+	Member
+	Expires time.Time `json:"expires"`
+}
+
+// 候选者保存在锁目录下的 group.members 文件中, 通过 file.Update 原子地修改
+type fileRegistry struct{}
+
+func FileRegistry() Registry {
+	return fileRegistry{}
+}
+
+func (fileRegistry) read(path string) (map[string]*registration, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]*registration{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeRegistrations(b), nil
+}
+
+// 内容损坏时视为没有候选者, 各候选者会在下次心跳时重新加入
+func decodeRegistrations(b []byte) map[string]*registration {
+	registrations := map[string]*registration{}
+	if len(b) > 0 && json.Unmarshal(b, &registrations) != nil {
+		return map[string]*registration{}
+	}
+	return registrations
+}
+
+func (fileRegistry) update(ctx context.Context, group string, fn func(map[string]*registration)) error {
+	path, err := file.Path(group, ".members")
+	if err != nil {
+		return err
+	}
+	return file.Update(ctx, path, func(old []byte) ([]byte, error) {
+		registrations := decodeRegistrations(old)
+		now := time.Now()
+		for identity, r := range registrations {
+			if now.After(r.Expires) {
+				delete(registrations, identity)
+			}
+		}
+		fn(registrations)
+		return json.Marshal(registrations)
+	})
+}
+
+func (r fileRegistry) Heartbeat(ctx context.Context, group string, member Member, ttl time.Duration) error {
+	return r.update(ctx, group, func(registrations map[string]*registration) {
+		// 过期的候选者已被清理, 视为重新加入
+		member.JoinedAt = time.Now()
+		if joined, ok := registrations[member.Identity]; ok {
+			member.JoinedAt = joined.JoinedAt
+		}
+		registrations[member.Identity] = &registration{Member: member, Expires: time.Now().Add(ttl)}
+	})
+}
+
+func (r fileRegistry) Leave(ctx context.Context, group, identity string) error {
+	return r.update(ctx, group, func(registrations map[string]*registration) {
+		delete(registrations, identity)
+	})
+}
+
+func (r fileRegistry) Members(_ context.Context, group string) ([]Member, error) {
+	path, err := file.Path(group, ".members")
+	if err != nil {
+		return nil, err
+	}
+	registrations, err := r.read(path)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	members := make([]Member, 0, len(registrations))
+	for _, r := range registrations {
+		if now.Before(r.Expires) {
+			members = append(members, r.Member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Identity < members[j].Identity })
+	return members, nil
+}
@@ -0,0 +1,82 @@
+package leaderelection
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/J-guanghua/rwlock/db"
+)
+
+const membersTable = `CREATE TABLE IF NOT EXISTS rwlock_members (
+	grp VARCHAR(64) NOT NULL,
+	identity VARCHAR(255) NOT NULL,
+	priority INT NOT NULL DEFAULT 0,
+	joined_at DATETIME(6) NOT NULL,
+	expires_at DATETIME(6) NOT NULL,
+	PRIMARY KEY (grp, identity)
+)`
+
+// 候选者保存在 group 所在的数据库中, 过期时间以数据库时间计算, 不受各节点时钟偏差影响
+type mysqlRegistry struct{}
+
+func MysqlRegistry() Registry {
+	return mysqlRegistry{}
+}
+
+func (mysqlRegistry) db(ctx context.Context, group string) (*sql.DB, string, error) {
+	key, err := db.Key(group)
+	if err != nil {
+		return nil, "", err
+	}
+	d := db.DB(group)
+	if err = db.EnsureTable(ctx, d, membersTable); err != nil {
+		return nil, "", err
+	}
+	return d, key, nil
+}
+
+func (r mysqlRegistry) Heartbeat(ctx context.Context, group string, member Member, ttl time.Duration) error {
+	d, key, err := r.db(ctx, group)
+	if err != nil {
+		return err
+	}
+	// 加入时间以数据库时间计算, 先按旧的过期时间决定是否重新加入, 再更新过期时间
+	_, err = d.ExecContext(ctx, `INSERT INTO rwlock_members (grp, identity, priority, joined_at, expires_at)
+		VALUES (?, ?, ?, NOW(6), NOW(6) + INTERVAL ? MICROSECOND)
+		ON DUPLICATE KEY UPDATE joined_at = IF(expires_at < NOW(6), VALUES(joined_at), joined_at),
+		priority = VALUES(priority), expires_at = VALUES(expires_at)`,
+		key, member.Identity, member.Priority, ttl.Microseconds())
+	return err
+}
+
+func (r mysqlRegistry) Leave(ctx context.Context, group, identity string) error {
+	d, key, err := r.db(ctx, group)
+	if err != nil {
+		return err
+	}
+	_, err = d.ExecContext(ctx, "DELETE FROM rwlock_members WHERE grp = ? AND identity = ?", key, identity)
+	return err
+}
+
+func (r mysqlRegistry) Members(ctx context.Context, group string) ([]Member, error) {
+	d, key, err := r.db(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := d.QueryContext(ctx, `SELECT identity, priority, joined_at FROM rwlock_members
+		WHERE grp = ? AND expires_at > NOW(6) ORDER BY identity`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []Member
+	for rows.Next() {
+		member := Member{}
+		if err = rows.Scan(&member.Identity, &member.Priority, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
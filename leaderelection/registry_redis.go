@@ -0,0 +1,87 @@
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	rwredis "github.com/J-guanghua/rwlock/redis"
+	"github.com/go-redis/redis/v8"
+)
+
+// Lua 脚本, 清理过期的候选者后返回全部候选者的信息
+var membersScript = redis.NewScript(`
+	local expired = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1])
+	for _, identity in ipairs(expired) do
+		redis.call("HDEL", KEYS[2], identity)
+	end
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[1])
+	return redis.call("HVALS", KEYS[2])
+`)
+
+// 有序集合保存各候选者的过期时间, 哈希表保存候选者的信息, 各节点的时钟需要同步
+type redisRegistry struct{}
+
+func RedisRegistry() Registry {
+	return redisRegistry{}
+}
+
+func (redisRegistry) keys(group string) []string {
+	return []string{"leader-members:" + group, "leader-member-info:" + group}
+}
+
+func (r redisRegistry) Heartbeat(ctx context.Context, group string, member Member, ttl time.Duration) error {
+	keys := r.keys(group)
+	client := rwredis.Client(group)
+	// 仍存活时保留加入时间, 已过期的候选者视为重新加入
+	member.JoinedAt = time.Now()
+	if score, err := client.ZScore(ctx, keys[0], member.Identity).Result(); err == nil &&
+		score > float64(time.Now().UnixMilli()) {
+		if b, err := client.HGet(ctx, keys[1], member.Identity).Bytes(); err == nil {
+			joined := Member{}
+			if json.Unmarshal(b, &joined) == nil {
+				member.JoinedAt = joined.JoinedAt
+			}
+		}
+	}
+	b, err := json.Marshal(&member)
+	if err != nil {
+		return err
+	}
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, keys[0], &redis.Z{Score: float64(time.Now().Add(ttl).UnixMilli()), Member: member.Identity})
+		pipe.HSet(ctx, keys[1], member.Identity, b)
+		return nil
+	})
+	return err
+}
+
+func (r redisRegistry) Leave(ctx context.Context, group, identity string) error {
+	keys := r.keys(group)
+	_, err := rwredis.Client(group).TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, keys[0], identity)
+		pipe.HDel(ctx, keys[1], identity)
+		return nil
+	})
+	return err
+}
+
+func (r redisRegistry) Members(ctx context.Context, group string) ([]Member, error) {
+	values, err := membersScript.Run(ctx, rwredis.Client(group), r.keys(group),
+		strconv.FormatInt(time.Now().UnixMilli(), 10)).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]Member, 0, len(values))
+	for _, v := range values {
+		member := Member{}
+		if err = json.Unmarshal([]byte(v), &member); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Identity < members[j].Identity })
+	return members, nil
+}
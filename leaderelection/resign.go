@@ -0,0 +1,120 @@
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrDrainTimeout   = errors.New("OnStartedLeading did not return before the drain timeout")
+	ErrNotNominatable = errors.New("election backend does not support nomination")
+)
+
+// Nominator 支持提名继任者的后端, 提名窗口内其他节点当选后会立即让出
+type Nominator interface {
+	// 提名 identity 在 window 内优先当选
+	Nominate(ctx context.Context, name, identity string, window time.Duration) error
+	// 窗口内的被提名者, 没有时返回空字符串
+	Nominee(ctx context.Context, name string) (string, error)
+}
+
+type resignation struct {
+	nominee string
+	window  time.Duration
+	drain   time.Duration
+	done    chan error
+}
+
+type ResignOption func(r *resignation)
+
+// 提名继任者, 在提名窗口内优先当选
+func WithNominee(identity string) ResignOption {
+	return func(r *resignation) {
+		r.nominee = identity
+	}
+}
+
+// 提名窗口, 默认为 2 倍 RetryPeriod, 保证被提名者至少重试一次
+func WithNominationWindow(window time.Duration) ResignOption {
+	return func(r *resignation) {
+		r.window = window
+	}
+}
+
+// 等待 OnStartedLeading 返回的最长时间, 默认为 RenewDeadline, 超时后仍然释放
+func WithDrainTimeout(timeout time.Duration) ResignOption {
+	return func(r *resignation) {
+		r.drain = timeout
+	}
+}
+
+// Resign 主动放弃领导权, 取消 OnStartedLeading 的 ctx 并等待其返回后再释放锁
+// Run 会在 RetryPeriod 后重新参与竞选, 未当选时返回 ErrNotLeader
+func (e *Elector) Resign(ctx context.Context, opts ...ResignOption) error {
+	r := &resignation{
+		window: 2 * e.Config.RetryPeriod,
+		drain:  e.Config.RenewDeadline,
+		done:   make(chan error, 1),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	if _, ok := e.Backend.(Nominator); r.nominee != "" && !ok {
+		return ErrNotNominatable
+	}
+	e.mtx.Lock()
+	t := e.current
+	e.mtx.Unlock()
+	if t == nil || atomic.LoadInt32(&t.elected) == 0 {
+		return ErrNotLeader
+	}
+	select {
+	case t.resign <- r:
+	case <-t.done:
+		return ErrNotLeader
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-r.done
+}
+
+// 等待 OnStartedLeading 返回, 提名继任者后释放锁
+func (t *term) resignLeading(backend ElectionBackend, name string, record *LeaderRecord,
+	configuration LeaderElectionConfig, r *resignation) error {
+	drained := make(chan struct{})
+	go func() {
+		t.leading.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-time.After(r.drain):
+		err = ErrDrainTimeout
+	}
+	configuration.OnStoppedLeading(configuration.GetIdentityID())
+
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if nominator, ok := backend.(Nominator); ok && r.nominee != "" {
+		if nerr := nominator.Nominate(ctx, name, r.nominee, r.window); err == nil {
+			err = nerr
+		}
+	}
+	if rerr := backend.Release(ctx, name, record); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// 提名窗口内被提名的是其他节点
+func yields(ctx context.Context, backend ElectionBackend, name, identity string) bool {
+	nominator, ok := backend.(Nominator)
+	if !ok {
+		return false
+	}
+	nominee, err := nominator.Nominee(ctx, name)
+	return err == nil && nominee != "" && nominee != identity
+}
@@ -0,0 +1,147 @@
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Service 只在 Leader 上运行的服务, Start 阻塞直到 ctx 结束
+// ctx 结束前返回 error 视为崩溃, 返回 nil 视为正常结束
+type Service interface {
+	Start(ctx context.Context) error
+}
+
+// ServiceFunc 将函数适配为 Service
+type ServiceFunc func(ctx context.Context) error
+
+func (f ServiceFunc) Start(ctx context.Context) error {
+	return f(ctx)
+}
+
+type service struct {
+	name    string
+	service Service
+}
+
+// 运行中的服务
+type running struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Runner 当选后按注册顺序启动服务, 失去领导权时按相反顺序逐个停止
+// 全部服务停止或超过 DrainTimeout 后 OnStartedLeading 才返回, Resign 据此等待服务停止后再释放锁
+type Runner struct {
+	Elector *Elector
+	// 停止全部服务的最长时间, 默认为 RenewDeadline
+	DrainTimeout time.Duration
+	// 服务崩溃时主动放弃领导权, 否则其余服务继续运行
+	ResignOnCrash bool
+	// 服务崩溃或停止超时时调用, 超时时 err 为 ErrDrainTimeout
+	// ResignOnCrash 时放弃领导权失败也会调用, err 为 Resign 返回的错误
+	OnCrash func(name string, err error)
+
+	mtx      sync.Mutex
+	services []service
+}
+
+func NewRunner(elector *Elector) *Runner {
+	return &Runner{Elector: elector}
+}
+
+// Register 注册服务, 在下一次当选时生效
+func (r *Runner) Register(name string, s Service) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.services = append(r.services, service{name: name, service: s})
+}
+
+// Run 以 Runner 作为 OnStartedLeading 运行 Elector, 直到 ctx 结束
+func (r *Runner) Run(ctx context.Context) {
+	if r.DrainTimeout == 0 {
+		r.DrainTimeout = r.Elector.Config.RenewDeadline
+	}
+	if r.OnCrash == nil {
+		r.OnCrash = func(name string, err error) {}
+	}
+	r.Elector.Config.OnStartedLeading = r.lead
+	r.Elector.Run(ctx)
+}
+
+func (r *Runner) lead(ctx context.Context) {
+	r.mtx.Lock()
+	services := append([]service(nil), r.services...)
+	r.mtx.Unlock()
+	// 服务的 ctx 不随领导权一起结束, 以便按相反顺序停止
+	record, _ := RecordFromContext(ctx)
+	crashed := make(chan service, len(services))
+	started := make([]*running, 0, len(services))
+	for _, s := range services {
+		sctx, cancel := context.WithCancel(withRecord(context.Background(), &record))
+		run := &running{name: s.name, cancel: cancel, done: make(chan struct{})}
+		started = append(started, run)
+		go func(s service) {
+			defer close(run.done)
+			if err := s.service.Start(sctx); err != nil && sctx.Err() == nil {
+				r.OnCrash(s.name, err)
+				crashed <- s
+			}
+		}(s)
+	}
+	resigned := false
+	for !resigned {
+		select {
+		case <-ctx.Done():
+			resigned = true
+		case s := <-crashed:
+			if r.ResignOnCrash {
+				// Resign 等待本函数返回, 需要异步调用
+				go r.resign(ctx, s.name)
+				<-ctx.Done()
+				resigned = true
+			}
+		}
+	}
+	r.stop(started)
+}
+
+// 放弃领导权, 失败时通过 OnCrash 通知并每隔 RetryPeriod 重试, 直到失去领导权
+func (r *Runner) resign(ctx context.Context, name string) {
+	for {
+		err := r.Elector.Resign(context.Background())
+		if err == nil || errors.Is(err, ErrNotLeader) {
+			return
+		}
+		r.OnCrash(name, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jitter(r.Elector.Config.RetryPeriod)):
+		}
+	}
+}
+
+func (r *Runner) stop(started []*running) {
+	timer := time.NewTimer(r.DrainTimeout)
+	defer timer.Stop()
+	for i := len(started) - 1; i >= 0; i-- {
+		started[i].cancel()
+		select {
+		case <-started[i].done:
+		case <-timer.C:
+			// 超时后不再等待, 其余服务只通知停止
+			for ; i >= 0; i-- {
+				started[i].cancel()
+				select {
+				case <-started[i].done:
+				default:
+					r.OnCrash(started[i].name, ErrDrainTimeout)
+				}
+			}
+			return
+		}
+	}
+}
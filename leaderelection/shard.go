@@ -0,0 +1,234 @@
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShardConfig 分片领导权的配置
+type ShardConfig struct {
+	IdentityID string
+	// 全部分片的名称, 各候选者的配置需要一致
+	Shards []string
+	// 分片锁的续期期限, 同时决定心跳和重新平衡的间隔 RenewDeadline/3
+	RenewDeadline time.Duration
+	// 获得分片后在单独的协程中调用, 失去该分片时 ctx 结束, 返回后才调用 OnRevoked
+	OnAssigned func(ctx context.Context, shard string)
+	// 失去分片后调用, 返回后才释放分片锁, 其他候选者在此之后才能获得该分片
+	OnRevoked func(shard string)
+}
+
+func (sc *ShardConfig) Init() {
+	if sc.RenewDeadline == 0 {
+		sc.RenewDeadline = 15 * time.Second
+	}
+	if sc.OnAssigned == nil {
+		sc.OnAssigned = func(ctx context.Context, shard string) {}
+	}
+	if sc.OnRevoked == nil {
+		sc.OnRevoked = func(shard string) {}
+	}
+}
+
+func (sc *ShardConfig) GetIdentityID() string {
+	if sc.IdentityID == "" {
+		sc.IdentityID = uuid.NewString()
+	}
+	return sc.IdentityID
+}
+
+// 持有中的分片
+type ownedShard struct {
+	record  *LeaderRecord
+	renewed time.Time
+	cancel  context.CancelFunc
+	// OnAssigned 返回后关闭
+	done chan struct{}
+}
+
+// ShardManager 将一组分片均衡地分配给存活的候选者, 每个分片由独立的选举保证同一时刻只有一个持有者
+// 候选者通过 Registry 心跳登记, 各候选者根据相同的成员列表计算相同的分配结果
+// 成员变化时先由原持有者让出分片, 新的持有者在下一轮获得
+type ShardManager struct {
+	backend  ElectionBackend
+	registry Registry
+	group    string
+	config   ShardConfig
+	mtx      sync.Mutex
+	owned    map[string]*ownedShard
+}
+
+// NewShardManager 分片 shard 的锁名为 group.shard, 后端实现 BlockingBackend 时也只尝试一次
+func NewShardManager(backend ElectionBackend, registry Registry, group string, config ShardConfig) *ShardManager {
+	return &ShardManager{backend: backend, registry: registry, group: group, config: config}
+}
+
+func NewRedisShardManager(group string, config ShardConfig) *ShardManager {
+	return NewShardManager(RedisBackend(), RedisRegistry(), group, config)
+}
+
+func NewMysqlShardManager(group string, config ShardConfig) *ShardManager {
+	return NewShardManager(MysqlBackend(), MysqlRegistry(), group, config)
+}
+
+func NewFileShardManager(group string, config ShardConfig) *ShardManager {
+	return NewShardManager(FileBackend(), FileRegistry(), group, config)
+}
+
+// Assigned 当前持有的分片
+func (m *ShardManager) Assigned() []string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	shards := make([]string, 0, len(m.owned))
+	for shard := range m.owned {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+	return shards
+}
+
+// Run 参与分片直到 ctx 结束, 结束时让出全部分片并离开
+func (m *ShardManager) Run(ctx context.Context) {
+	m.config.Init()
+	m.mtx.Lock()
+	m.owned = map[string]*ownedShard{}
+	m.mtx.Unlock()
+	member := Member{Identity: m.config.GetIdentityID()}
+	ttl := m.config.RenewDeadline + 2*time.Second
+	ticker := time.NewTicker(m.config.RenewDeadline / 3)
+	defer ticker.Stop()
+	for {
+		m.rebalance(ctx, member, ttl)
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+			defer cancel()
+			for shard := range m.owned {
+				m.revoke(releaseCtx, shard)
+			}
+			_ = m.registry.Leave(releaseCtx, m.group, member.Identity)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *ShardManager) lockName(shard string) string {
+	return m.group + "." + shard
+}
+
+func (m *ShardManager) rebalance(ctx context.Context, member Member, ttl time.Duration) {
+	_ = m.registry.Heartbeat(ctx, m.group, member, ttl)
+	members, err := m.registry.Members(ctx, m.group)
+	if err != nil {
+		// 成员未知时只续期已持有的分片
+		m.renew(ctx, nil, ttl)
+		return
+	}
+	identities := []string{member.Identity}
+	for _, mb := range members {
+		if mb.Identity != member.Identity {
+			identities = append(identities, mb.Identity)
+		}
+	}
+	desired := map[string]bool{}
+	for shard, owner := range assign(m.config.Shards, identities) {
+		if owner == member.Identity {
+			desired[shard] = true
+		}
+	}
+	m.renew(ctx, desired, ttl)
+	for _, shard := range m.config.Shards {
+		if !desired[shard] || m.owned[shard] != nil || ctx.Err() != nil {
+			continue
+		}
+		record, err := m.backend.TryAcquire(ctx, m.lockName(shard), member.Identity, ttl)
+		if err != nil {
+			// 原持有者尚未让出, 下一轮重试
+			continue
+		}
+		shardCtx, cancel := context.WithCancel(withRecord(ctx, record))
+		owned := &ownedShard{record: record, renewed: time.Now(), cancel: cancel, done: make(chan struct{})}
+		m.mtx.Lock()
+		m.owned[shard] = owned
+		m.mtx.Unlock()
+		// 回调阻塞时不影响其他分片的续期
+		go func(shard string) {
+			defer close(owned.done)
+			m.config.OnAssigned(shardCtx, shard)
+		}(shard)
+	}
+}
+
+// 续期持有的分片, 不再分配给自己或续期失败的分片被让出, desired 为 nil 时保留全部分片
+func (m *ShardManager) renew(ctx context.Context, desired map[string]bool, ttl time.Duration) {
+	for shard, owned := range m.owned {
+		if desired != nil && !desired[shard] {
+			m.revoke(ctx, shard)
+			continue
+		}
+		err := m.backend.Renew(ctx, m.lockName(shard), owned.record, ttl)
+		if err == nil {
+			owned.renewed = time.Now()
+		} else if errors.Is(err, ErrNotLeader) || time.Since(owned.renewed) > m.config.RenewDeadline {
+			m.revoke(ctx, shard)
+		}
+	}
+}
+
+func (m *ShardManager) revoke(ctx context.Context, shard string) {
+	m.mtx.Lock()
+	owned := m.owned[shard]
+	delete(m.owned, shard)
+	m.mtx.Unlock()
+	owned.cancel()
+	<-owned.done
+	m.config.OnRevoked(shard)
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), releaseTimeout)
+		defer cancel()
+	}
+	_ = m.backend.Release(ctx, m.lockName(shard), owned.record)
+}
+
+// 有界负载的最高随机权重哈希, 每个候选者最多分得 ceil(分片数/候选者数) 个分片
+// 候选者变化时大部分分片保持原有的归属
+func assign(shards, members []string) map[string]string {
+	owners := make(map[string]string, len(shards))
+	if len(members) == 0 {
+		return owners
+	}
+	capacity := (len(shards) + len(members) - 1) / len(members)
+	load := make(map[string]int, len(members))
+	ranked := make([]string, len(members))
+	for _, shard := range shards {
+		copy(ranked, members)
+		weights := make(map[string]uint64, len(members))
+		for _, member := range members {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(member + "\x00" + shard))
+			weights[member] = h.Sum64()
+		}
+		sort.Slice(ranked, func(i, j int) bool {
+			if weights[ranked[i]] != weights[ranked[j]] {
+				return weights[ranked[i]] > weights[ranked[j]]
+			}
+			return ranked[i] < ranked[j]
+		})
+		for _, member := range ranked {
+			if load[member] < capacity {
+				owners[shard] = member
+				load[member]++
+				break
+			}
+		}
+	}
+	return owners
+}
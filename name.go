@@ -0,0 +1,121 @@
+package rwlock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrInvalidName = errors.New("invalid lock name")
+
+// 哈希后缀长度, sha256 前 8 字节的十六进制
+const digestLength = 16
+
+// Name 规范化后的锁名称
+// Key 为后端实际使用的键, Original 保留调用方传入的名称用于诊断
+type Name struct {
+	Original string
+	Key      string
+}
+
+func (n Name) String() string {
+	if n.Original == n.Key {
+		return n.Key
+	}
+	return fmt.Sprintf("%s(%s)", n.Original, n.Key)
+}
+
+// NamePolicy 锁名称规则, 各后端按自身的限制配置
+type NamePolicy struct {
+	// 命名空间与名称之间的分隔符
+	Separator string
+	// 键的最大字节数, 0 表示不限制
+	MaxLength int
+	// 判断字符能否直接用于键, nil 表示全部可用
+	Safe func(r rune) bool
+	// 允许非 UTF-8 的名称, 键可以是任意字节时使用
+	Binary bool
+}
+
+// Normalize 校验名称并生成后端使用的键
+// 含不安全字符或超长的名称会被替换为 可读前缀-哈希 的形式, 同一名称总是得到同一个键
+func (p NamePolicy) Normalize(namespace, name string) (Name, error) {
+	n := Name{Original: name}
+	if !p.valid(name) {
+		return n, fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	var prefix string
+	if namespace != "" {
+		if !p.valid(namespace) || !p.safe(namespace) {
+			return n, fmt.Errorf("%w: namespace %q", ErrInvalidName, namespace)
+		}
+		prefix = namespace + p.Separator
+	}
+	if p.MaxLength > 0 && len(prefix)+digestLength+1 > p.MaxLength {
+		return n, fmt.Errorf("%w: namespace %q too long", ErrInvalidName, namespace)
+	}
+	n.Key = prefix + name
+	if !p.safe(name) || (p.MaxLength > 0 && len(n.Key) > p.MaxLength) {
+		n.Key = prefix + p.hash(name, len(prefix))
+	}
+	return n, nil
+}
+
+// InvalidMutex 名称不合法时由各后端返回, 所有操作都返回 err
+func InvalidMutex(err error) RWMutex {
+	return invalidMutex{err: err}
+}
+
+type invalidMutex struct {
+	err error
+}
+
+func (m invalidMutex) Lock(context.Context) error    { return m.err }
+func (m invalidMutex) Unlock(context.Context) error  { return m.err }
+func (m invalidMutex) RLock(context.Context) error   { return m.err }
+func (m invalidMutex) RUnlock(context.Context) error { return m.err }
+
+func (p NamePolicy) safe(name string) bool {
+	if p.Safe == nil {
+		return true
+	}
+	for _, r := range name {
+		if !p.Safe(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p NamePolicy) hash(name string, used int) string {
+	sum := sha256.Sum256([]byte(name))
+	digest := hex.EncodeToString(sum[:])[:digestLength]
+	var b strings.Builder
+	for _, r := range name {
+		if p.Safe != nil && !p.Safe(r) {
+			r = '_'
+		}
+		if p.MaxLength > 0 && used+b.Len()+utf8.RuneLen(r)+digestLength+1 > p.MaxLength {
+			break
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return digest
+	}
+	return b.String() + "-" + digest
+}
+
+func (p NamePolicy) valid(name string) bool {
+	return name != "" && (p.Binary || utf8.ValidString(name)) && !strings.ContainsRune(name, 0)
+}
+
+// PathSafe 可直接作为文件名的字符
+func PathSafe(r rune) bool {
+	return unicode.IsPrint(r) && !strings.ContainsRune(`/\:*?"<>|`, r)
+}
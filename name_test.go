@@ -0,0 +1,85 @@
+package rwlock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	file := NamePolicy{Separator: ".", MaxLength: 200, Safe: PathSafe}
+	mysql := NamePolicy{Separator: ":", MaxLength: 64}
+	tests := []struct {
+		policy    NamePolicy
+		namespace string
+		name      string
+		hashed    bool
+	}{
+		{file, "", "group-1", false},
+		{file, "order", "group-1", false},
+		{file, "", "../../etc/x", true},
+		{file, "", `C:\tmp\x`, true},
+		{file, "", strings.Repeat("a", 300), true},
+		{mysql, "order", strings.Repeat("b", 40), false},
+		{mysql, "order", strings.Repeat("b", 64), true},
+	}
+	for _, tt := range tests {
+		n, err := tt.policy.Normalize(tt.namespace, tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Original != tt.name {
+			t.Errorf("原始名称丢失: %v", n)
+		}
+		if hashed := n.Key != tt.name && n.Key != tt.namespace+tt.policy.Separator+tt.name; hashed != tt.hashed {
+			t.Errorf("%q 哈希结果 %v, 期望 %v", tt.name, n.Key, tt.hashed)
+		}
+		if tt.policy.MaxLength > 0 && len(n.Key) > tt.policy.MaxLength {
+			t.Errorf("%q 超出长度限制: %d", n.Key, len(n.Key))
+		}
+		if !tt.policy.safe(n.Key) {
+			t.Errorf("%q 包含不安全字符", n.Key)
+		}
+		if again, _ := tt.policy.Normalize(tt.namespace, tt.name); again != n {
+			t.Errorf("结果不确定: %v != %v", again, n)
+		}
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	policy := NamePolicy{Separator: ".", MaxLength: 200, Safe: PathSafe}
+	for _, name := range []string{"", "a\x00b", "\xff"} {
+		if _, err := policy.Normalize("", name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%q 应校验失败: %v", name, err)
+		}
+	}
+	if _, err := policy.Normalize("a/b", "name"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("命名空间应校验失败: %v", err)
+	}
+}
+
+func TestNormalizeBinary(t *testing.T) {
+	policy := NamePolicy{Separator: ":", Binary: true}
+	n, err := policy.Normalize("", "\xff\xfe")
+	if err != nil || n.Key != "\xff\xfe" {
+		t.Errorf("非 UTF-8 名称应原样使用: %q %v", n.Key, err)
+	}
+	if _, err := policy.Normalize("", "a\x00b"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("含 NUL 的名称应校验失败: %v", err)
+	}
+	if _, err := policy.Normalize("", ""); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("空名称应校验失败: %v", err)
+	}
+}
+
+func TestInvalidMutex(t *testing.T) {
+	_, err := NamePolicy{}.Normalize("", "")
+	mutex := InvalidMutex(err)
+	if err := mutex.Lock(context.Background()); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Lock 应返回名称错误: %v", err)
+	}
+	if err := mutex.Unlock(context.Background()); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Unlock 应返回名称错误: %v", err)
+	}
+}
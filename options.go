@@ -8,7 +8,10 @@ import (
 	"time"
 )
 
-var ErrFailed = errors.New("Lock acquisition failure")
+var (
+	ErrFailed    = errors.New("Lock acquisition failure")
+	ErrNotLocked = errors.New("unlock of unlocked mutex")
+)
 
 type Mutex interface {
 	Lock(ctx context.Context) error
@@ -22,6 +25,7 @@ type RWMutex interface {
 }
 
 type Options struct {
+	Namespace string
 	Value     string
 	Expiry    time.Duration
 	Tries     int
@@ -55,6 +59,13 @@ func WithValue(v string) Option {
 	}
 }
 
+// 锁名称的命名空间, 作为键前缀区分不同业务
+func WithNamespace(namespace string) Option {
+	return func(ops *Options) {
+		ops.Namespace = namespace
+	}
+}
+
 func WithExpiry(expiry time.Duration) Option {
 	return func(ops *Options) {
 		ops.Expiry = expiry
@@ -42,7 +42,7 @@ var (
 )
 
 type rwRedis struct {
-	name   string
+	name   rwlock.Name
 	sema   uint32
 	wait   int32
 	client *redis.Client
@@ -79,7 +79,7 @@ LoopLock:
 		err = r.acquireLock(ctx, options)
 		if errors.Is(err, rwlock.ErrFailed) {
 			if options.Tries > 0 && tries >= options.Tries {
-				return fmt.Errorf("尝试 %d 次,获取锁失败", tries)
+				return fmt.Errorf("尝试 %d 次,获取锁失败: %w", tries, rwlock.ErrFailed)
 			}
 			goto LoopLock
 		} else if err != nil {
@@ -92,7 +92,7 @@ LoopLock:
 func (r *rwRedis) Unlock(ctx context.Context) error {
 	r.cancel()
 	atomic.AddInt32(&r.wait, -1)
-	_, err := releaseScript.Eval(ctx, r.client, []string{r.name}, r.opts.Value).Result()
+	_, err := releaseScript.Eval(ctx, r.client, []string{r.name.Key}, r.opts.Value).Result()
 	atomic.StoreUint32(&r.sema, 0)
 	r.notify(rwlock.GetGoroutineID())
 	return err
@@ -101,14 +101,14 @@ func (r *rwRedis) Unlock(ctx context.Context) error {
 // 尝试获取锁，如果获取失败 通知到休眠协程
 func (r *rwRedis) acquireLock(ctx context.Context, opts *rwlock.Options) error {
 	expiry := int(opts.Expiry / time.Millisecond)
-	result, err := acquireScript.Eval(ctx, r.client, []string{r.name}, opts.Value, expiry).Result()
+	result, err := acquireScript.Eval(ctx, r.client, []string{r.name.Key}, opts.Value, expiry).Result()
 	if err != nil {
 		return err
 	}
 	if result == int64(1) {
 		ctx, r.cancel = context.WithCancel(ctx)
 		atomic.StoreUint32(&r.sema, uint32(rwlock.GetGoroutineID()))
-		go r.touchRenewal(&rwlock.Renewal{Ctx: ctx, Name: r.name, Cancel: r.cancel})
+		go r.touchRenewal(&rwlock.Renewal{Ctx: ctx, Name: r.name.Original, Cancel: r.cancel})
 		return nil
 	} else if r.sema == 0 {
 		r.notify(rwlock.GetGoroutineID())
@@ -126,7 +126,7 @@ func (r *rwRedis) touchRenewal(renewal *rwlock.Renewal) {
 		case <-time.After(opts.Expiry - 2000*time.Millisecond):
 			expiry := int(opts.Expiry / time.Millisecond)
 			result, err := touchScript.Eval(renewal.Ctx,
-				r.client, []string{renewal.Name}, opts.Value, expiry).Result()
+				r.client, []string{r.name.Key}, opts.Value, expiry).Result()
 			renewal.Err = err
 			renewal.Result = result == int64(1)
 			r.opts.OnRenewal(renewal)
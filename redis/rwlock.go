@@ -2,7 +2,9 @@ package redis
 
 import (
 	"context"
+	"hash/fnv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/J-guanghua/rwlock"
@@ -33,19 +35,43 @@ func Init(options ...*redis.Options) {
 	}
 }
 
+// redis 的键没有字符限制, 只需要命名空间
+var namePolicy = rwlock.NamePolicy{Separator: ":", Binary: true}
+
 func (rw *rwLock) allocation(name string, opts *rwlock.Options) rwlock.Mutex {
+	n, err := namePolicy.Normalize(opts.Namespace, name)
+	if err != nil {
+		return rwlock.InvalidMutex(err)
+	}
 	rw.mtx.Lock()
 	defer rw.mtx.Unlock()
-	if rw.mutex[name] == nil {
+	if rw.mutex[n.Key] == nil {
 		index := len(rw.mutex) % len(rw.pool)
-		rw.mutex[name] = &rwRedis{
-			name:   name,
+		rw.mutex[n.Key] = &rwRedis{
+			name:   n,
 			opts:   opts,
 			client: rw.pool[index],
 			signal: make(chan struct{}, 1),
 		}
 	}
-	return rw.mutex[name]
+	return rw.mutex[n.Key]
+}
+
+// 未被本进程持有时从缓存中移除
+func (rw *rwLock) evict(r *rwRedis) {
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	if rw.mutex[r.name.Key] == r && atomic.LoadUint32(&r.sema) == 0 {
+		delete(rw.mutex, r.name.Key)
+	}
+}
+
+// Client 按名称哈希选择连接, 不同进程对同一名称选择同一个 redis
+// 供需要在锁之外保存数据的场景使用, 如 Leader 记录
+func Client(name string) *redis.Client {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return rlock.pool[h.Sum32()%uint32(len(rlock.pool))]
 }
 
 func Mutex(name string, opts ...rwlock.Option) rwlock.Mutex {
@@ -60,6 +86,33 @@ func Mutex(name string, opts ...rwlock.Option) rwlock.Mutex {
 	return rlock.allocation(name, opt)
 }
 
+// OnceMutex 与 Mutex 相同, Unlock 或加锁失败后从缓存中移除
+// 适用于只使用一次的锁名称, 如定时任务的每次调度, 移除后不要再使用
+func OnceMutex(name string, opts ...rwlock.Option) rwlock.Mutex {
+	mutex := Mutex(name, opts...)
+	if r, ok := mutex.(*rwRedis); ok {
+		return onceMutex{r}
+	}
+	return mutex
+}
+
+type onceMutex struct {
+	*rwRedis
+}
+
+func (m onceMutex) Lock(ctx context.Context) error {
+	err := m.rwRedis.Lock(ctx)
+	if err != nil {
+		rlock.evict(m.rwRedis)
+	}
+	return err
+}
+
+func (m onceMutex) Unlock(ctx context.Context) error {
+	defer rlock.evict(m.rwRedis)
+	return m.rwRedis.Unlock(ctx)
+}
+
 func RWMutex(name string, opts ...rwlock.Option) rwlock.RWMutex { // nolint
 	return nil
 }
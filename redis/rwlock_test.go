@@ -89,6 +89,25 @@ func TestWaitGroupAccount(_ *testing.T) {
 	log.Printf("账户余额:%v,并发 100000,剩余 %v,", 100002, account.balance)
 }
 
+func TestOnceMutex(t *testing.T) {
+	ctx := context.Background()
+	mutex := OnceMutex("guanghua-once", rwlock.WithTries(1))
+	if err := mutex.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := OnceMutex("guanghua-once", rwlock.WithTries(1)).Lock(ctx); err == nil {
+		t.Fatal("持有期间不应获取成功")
+	}
+	if err := mutex.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rlock.mtx.Lock()
+	defer rlock.mtx.Unlock()
+	if _, ok := rlock.mutex["guanghua-once"]; ok {
+		t.Fatal("释放后应从缓存中移除")
+	}
+}
+
 func BenchmarkRWMutex(b *testing.B) {
 	mutex := Mutex("test")
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSpec = errors.New("invalid cron spec")
+
+// 超过该时长仍没有匹配的时间时视为永不触发, 例如 2 月 30 日
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+// 字段的取值范围和名称
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	doms    = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 和 0 都表示周日
+	dows = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Schedule 解析后的 cron 表达式, 每个字段是一个位图
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// 日期和星期都有限制时满足其一即可, 与 cron 一致
+	domStar, dowStar bool
+}
+
+// Parse 解析标准的 5 个字段的 cron 表达式: 分 时 日 月 星期
+// 支持 *、a-b、*/n、a-b/n、逗号分隔的列表, 月份和星期的英文缩写, 以及 @hourly、@daily 等
+func Parse(spec string) (*Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if d, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w %q: expected 5 fields, got %d", ErrInvalidSpec, spec, len(fields))
+	}
+	s := &Schedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	var err error
+	for i, f := range []struct {
+		bits   *uint64
+		bounds bounds
+	}{{&s.minute, minutes}, {&s.hour, hours}, {&s.dom, doms}, {&s.month, months}, {&s.dow, dows}} {
+		if *f.bits, err = parseField(fields[i], f.bounds); err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidSpec, spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			rng, step = part[:i], uint(n)
+		}
+		start, end := b.min, b.max
+		switch i := strings.Index(rng, "-"); {
+		case rng == "*":
+		case i >= 0:
+			var err error
+			if start, err = parseValue(rng[:i], b); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(rng[i+1:], b); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if start, err = parseValue(rng, b); err != nil {
+				return 0, err
+			}
+			// a/n 表示从 a 开始到最大值, 单独的 a 只匹配 a
+			if step == 1 {
+				end = start
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("bad range %q", part)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || uint(v) < b.min || uint(v) > b.max {
+		return 0, fmt.Errorf("value %q out of range [%d, %d]", s, b.min, b.max)
+	}
+	return uint(v), nil
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next t 之后第一个满足表达式的时间, 以 t 的时区计算, 永不触发时返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(searchLimit)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,220 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/J-guanghua/rwlock"
+	"github.com/J-guanghua/rwlock/db"
+	"github.com/J-guanghua/rwlock/file"
+	rwredis "github.com/J-guanghua/rwlock/redis"
+)
+
+// Locker 创建任务锁, 与 redis.Mutex、db.Mutex、file.Mutex 的签名一致
+// 每次调度使用新的锁名称, 应使用释放后不再缓存的锁, 如 redis.OnceMutex、db.OnceMutex
+type Locker func(name string, opts ...rwlock.Option) rwlock.Mutex
+
+// MissedPolicy 错过调度时的处理方式, 例如所有实例都停机或执行时间超过调度间隔
+type MissedPolicy int
+
+const (
+	// 跳过错过的调度, 只执行调度时间在 Grace 内的一次
+	SkipMissed MissedPolicy = iota
+	// 只补执行最近错过的一次
+	CatchUpLatest
+	// 按顺序补执行错过的每一次, 最多 MaxCatchUp 次
+	CatchUpAll
+)
+
+// Job 定时任务, 同一 Name 的任务在所有实例上的 Spec 需要一致
+type Job struct {
+	Name string
+	Spec string
+	Run  func(ctx context.Context) error
+	// 默认为 SkipMissed
+	Missed MissedPolicy
+	// SkipMissed 时调度时间之后仍然执行的时长, 默认 1 分钟
+	Grace time.Duration
+	// CatchUpAll 时最多补执行的次数, 默认 100
+	MaxCatchUp int
+
+	schedule *Schedule
+}
+
+type scheduledKey struct{}
+
+// ScheduledFromContext 在 Job.Run 中获取本次执行的调度时间
+func ScheduledFromContext(ctx context.Context) time.Time {
+	scheduled, _ := ctx.Value(scheduledKey{}).(time.Time)
+	return scheduled
+}
+
+// Scheduler 在多个实例上运行相同的任务, 每次调度只由一个实例执行
+// 每次调度使用独立的锁, 锁名由任务名和调度时间组成, 获取锁失败的实例直接跳过
+// 获取锁后确认 Store 中没有更晚的成功记录才执行, 执行失败时其他实例仍可能重试该次调度
+type Scheduler struct {
+	Locker Locker
+	Store  Store
+	// 计算调度时间的时区, 默认为 time.Local
+	Location *time.Location
+	OnError  func(job string, scheduled time.Time, err error)
+
+	mtx  sync.Mutex
+	jobs []*Job
+}
+
+func New(locker Locker, store Store) *Scheduler {
+	return &Scheduler{Locker: locker, Store: store}
+}
+
+func NewRedisScheduler() *Scheduler {
+	return New(rwredis.OnceMutex, RedisStore())
+}
+
+func NewMysqlScheduler() *Scheduler {
+	return New(db.OnceMutex, MysqlStore())
+}
+
+// NewFileScheduler 每次调度会在锁目录下创建一个锁文件, 建议 file.Init 时使用 file.WithRemoveIdle
+func NewFileScheduler() *Scheduler {
+	return New(file.Mutex, FileStore())
+}
+
+// Add 添加任务, 需要在 Run 之前调用
+func (s *Scheduler) Add(job Job) error {
+	schedule, err := Parse(job.Spec)
+	if err != nil {
+		return err
+	}
+	if job.Grace == 0 {
+		job.Grace = time.Minute
+	}
+	if job.MaxCatchUp == 0 {
+		job.MaxCatchUp = 100
+	}
+	job.schedule = schedule
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.jobs = append(s.jobs, &job)
+	return nil
+}
+
+// Run 阻塞直到 ctx 结束, 每个任务在单独的协程中调度, 返回前等待执行中的任务结束
+func (s *Scheduler) Run(ctx context.Context) {
+	if s.Location == nil {
+		s.Location = time.Local
+	}
+	if s.OnError == nil {
+		s.OnError = func(job string, scheduled time.Time, err error) {}
+	}
+	s.mtx.Lock()
+	jobs := append([]*Job(nil), s.jobs...)
+	s.mtx.Unlock()
+	started := time.Now().In(s.Location)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			s.run(ctx, job, started)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) run(ctx context.Context, job *Job, started time.Time) {
+	// 本实例已处理到的时间
+	var cursor time.Time
+	for {
+		now := time.Now().In(s.Location)
+		base := cursor
+		last, err := s.Store.LastRun(ctx, job.Name)
+		if err != nil {
+			s.OnError(job.Name, time.Time{}, err)
+		} else if last.After(base) {
+			base = last
+		}
+		if base.IsZero() {
+			// 从未执行过的任务不补执行启动之前的调度
+			base = started
+		}
+		for _, scheduled := range due(job, base.In(s.Location), now) {
+			if ctx.Err() != nil {
+				return
+			}
+			s.execute(ctx, job, scheduled)
+		}
+		cursor = now
+		next := job.schedule.Next(now)
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// base 之后到 now 为止需要执行的调度时间
+func due(job *Job, base, now time.Time) []time.Time {
+	var missed []time.Time
+	for at := job.schedule.Next(base); !at.IsZero() && !at.After(now); at = job.schedule.Next(at) {
+		missed = append(missed, at)
+		if len(missed) > job.MaxCatchUp {
+			missed = missed[1:]
+		}
+	}
+	if len(missed) == 0 {
+		return nil
+	}
+	latest := missed[len(missed)-1]
+	switch job.Missed {
+	case CatchUpAll:
+		return missed
+	case CatchUpLatest:
+		return []time.Time{latest}
+	default:
+		if now.Sub(latest) <= job.Grace {
+			return []time.Time{latest}
+		}
+		return nil
+	}
+}
+
+func lockName(job string, scheduled time.Time) string {
+	return job + "@" + strconv.FormatInt(scheduled.Unix(), 10)
+}
+
+func (s *Scheduler) execute(ctx context.Context, job *Job, scheduled time.Time) {
+	mutex := s.Locker(lockName(job.Name, scheduled), rwlock.WithTries(1))
+	if err := mutex.Lock(ctx); err != nil {
+		// 其他实例正在执行
+		if !errors.Is(err, rwlock.ErrFailed) {
+			s.OnError(job.Name, scheduled, err)
+		}
+		return
+	}
+	defer mutex.Unlock(context.Background()) // nolint
+	last, err := s.Store.LastRun(ctx, job.Name)
+	if err != nil {
+		s.OnError(job.Name, scheduled, err)
+		return
+	} else if !last.Before(scheduled) {
+		// 其他实例已执行
+		return
+	}
+	if err = job.Run(context.WithValue(ctx, scheduledKey{}, scheduled)); err != nil {
+		s.OnError(job.Name, scheduled, err)
+		return
+	}
+	if err = s.Store.SetLastRun(ctx, job.Name, scheduled); err != nil {
+		s.OnError(job.Name, scheduled, err)
+	}
+}
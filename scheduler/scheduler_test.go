@@ -0,0 +1,156 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/J-guanghua/rwlock/file"
+)
+
+func TestParse(t *testing.T) {
+	from := time.Date(2024, 2, 10, 10, 7, 30, 0, time.UTC) // 周六
+	for _, c := range []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 2, 10, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * MON-FRI", time.Date(2024, 2, 12, 9, 0, 0, 0, time.UTC)},
+		{"30 8 1,15 * *", time.Date(2024, 2, 15, 8, 30, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, 2, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 2, 11, 12, 0, 0, 0, time.UTC)},
+		{"5-59/20 * * * *", time.Date(2024, 2, 10, 10, 25, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 2, 10, 11, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		schedule, err := Parse(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec, err)
+		}
+		if next := schedule.Next(from); !next.Equal(c.next) {
+			t.Errorf("%s: 期望 %v, 实际 %v", c.spec, c.next, next)
+		}
+	}
+	for _, spec := range []string{"60 * * * *", "* * *", "5-1 * * * *", "*/0 * * * *", "* * * JANUARY *"} {
+		if _, err := Parse(spec); !errors.Is(err, ErrInvalidSpec) {
+			t.Errorf("%s: 期望 ErrInvalidSpec, 实际 %v", spec, err)
+		}
+	}
+}
+
+func TestDue(t *testing.T) {
+	schedule, _ := Parse("* * * * *")
+	base := time.Date(2024, 2, 10, 10, 0, 0, 0, time.UTC)
+	now := base.Add(5*time.Minute + 30*time.Second)
+	for _, c := range []struct {
+		job  Job
+		want int
+	}{
+		{Job{Missed: SkipMissed, Grace: time.Minute, MaxCatchUp: 100}, 1},
+		{Job{Missed: SkipMissed, Grace: 10 * time.Second, MaxCatchUp: 100}, 0},
+		{Job{Missed: CatchUpLatest, MaxCatchUp: 100}, 1},
+		{Job{Missed: CatchUpAll, MaxCatchUp: 100}, 5},
+		{Job{Missed: CatchUpAll, MaxCatchUp: 3}, 3},
+	} {
+		c.job.schedule = schedule
+		got := due(&c.job, base, now)
+		if len(got) != c.want {
+			t.Fatalf("%+v: 期望 %d 次, 实际 %v", c.job, c.want, got)
+		}
+		if len(got) > 0 && !got[len(got)-1].Equal(base.Add(5*time.Minute)) {
+			t.Fatalf("最后一次调度时间错误: %v", got)
+		}
+	}
+}
+
+func TestExecuteOnce(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	var runs int32
+	release := make(chan struct{})
+	job := Job{Name: "report", Spec: "* * * * *", Run: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		<-release
+		return nil
+	}}
+	scheduled := time.Now().Truncate(time.Minute)
+	instances := []*Scheduler{NewFileScheduler(), NewFileScheduler(), NewFileScheduler()}
+	var wg sync.WaitGroup
+	for _, s := range instances {
+		if err := s.Add(job); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(s *Scheduler) {
+			defer wg.Done()
+			s.execute(context.Background(), s.jobs[0], scheduled)
+		}(s)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	// 执行完成后才到达的实例看到成功记录后跳过
+	instances[0].execute(context.Background(), instances[0].jobs[0], scheduled)
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("同一次调度执行了 %d 次", n)
+	}
+	last, err := FileStore().LastRun(context.Background(), "report")
+	if err != nil || !last.Equal(scheduled) {
+		t.Fatalf("成功记录错误: %v, %v", last, err)
+	}
+}
+
+func TestRunCatchUp(t *testing.T) {
+	file.Init(t.TempDir())
+	defer file.Close() // nolint
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 所有实例停机 5 分钟
+	latest := time.Now().Truncate(time.Minute)
+	if err := FileStore().SetLastRun(ctx, "catch-up", latest.Add(-5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	var mtx sync.Mutex
+	var ran []time.Time
+	s := NewFileScheduler()
+	err := s.Add(Job{Name: "catch-up", Spec: "* * * * *", Missed: CatchUpAll, Run: func(ctx context.Context) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		ran = append(ran, ScheduledFromContext(ctx))
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	defer func() { <-done }()
+	defer cancel()
+	for {
+		mtx.Lock()
+		n := len(ran)
+		mtx.Unlock()
+		if n >= 5 {
+			break
+		} else if ctx.Err() != nil {
+			t.Fatalf("只补执行了 %d 次", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	for i, at := range ran[:5] {
+		if want := latest.Add(time.Duration(i-4) * time.Minute); !at.Equal(want) {
+			t.Fatalf("第 %d 次补执行的调度时间错误: %v, 期望 %v", i, at, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/J-guanghua/rwlock/db"
+	"github.com/J-guanghua/rwlock/file"
+	rwredis "github.com/J-guanghua/rwlock/redis"
+	"github.com/go-redis/redis/v8"
+)
+
+// Store 记录每个任务最近一次成功执行的调度时间, 所有实例共用
+type Store interface {
+	// 从未成功执行时返回零值
+	LastRun(ctx context.Context, job string) (time.Time, error)
+	// 只会向后推进, 早于已记录时间的写入被忽略
+	SetLastRun(ctx context.Context, job string, scheduled time.Time) error
+}
+
+// Lua 脚本, 新的时间晚于已记录的时间时才写入
+var setLastRunScript = redis.NewScript(`
+	local last = redis.call("GET", KEYS[1])
+	if last and tonumber(last) >= tonumber(ARGV[1]) then
+		return 0
+	end
+	redis.call("SET", KEYS[1], ARGV[1])
+	return 1
+`)
+
+// 以毫秒时间戳保存在 scheduler-last:job 键中, 不过期
+type redisStore struct{}
+
+func RedisStore() Store {
+	return redisStore{}
+}
+
+func (redisStore) key(job string) string {
+	return "scheduler-last:" + job
+}
+
+func (s redisStore) LastRun(ctx context.Context, job string) (time.Time, error) {
+	ms, err := rwredis.Client(job).Get(ctx, s.key(job)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (s redisStore) SetLastRun(ctx context.Context, job string, scheduled time.Time) error {
+	return setLastRunScript.Run(ctx, rwredis.Client(job), []string{s.key(job)},
+		strconv.FormatInt(scheduled.UnixMilli(), 10)).Err()
+}
+
+const runsTable = `CREATE TABLE IF NOT EXISTS rwlock_scheduler (
+	job VARCHAR(64) NOT NULL PRIMARY KEY,
+	last_run DATETIME(6) NOT NULL
+)`
+
+// 保存在任务锁所在的数据库中
+type mysqlStore struct{}
+
+func MysqlStore() Store {
+	return mysqlStore{}
+}
+
+func (mysqlStore) db(ctx context.Context, job string) (*sql.DB, string, error) {
+	key, err := db.Key(job)
+	if err != nil {
+		return nil, "", err
+	}
+	d := db.DB(job)
+	if err = db.EnsureTable(ctx, d, runsTable); err != nil {
+		return nil, "", err
+	}
+	return d, key, nil
+}
+
+func (s mysqlStore) LastRun(ctx context.Context, job string) (time.Time, error) {
+	d, key, err := s.db(ctx, job)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	err = d.QueryRowContext(ctx, "SELECT last_run FROM rwlock_scheduler WHERE job = ?", key).Scan(&last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return last, err
+}
+
+func (s mysqlStore) SetLastRun(ctx context.Context, job string, scheduled time.Time) error {
+	d, key, err := s.db(ctx, job)
+	if err != nil {
+		return err
+	}
+	_, err = d.ExecContext(ctx, `INSERT INTO rwlock_scheduler (job, last_run) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE last_run = GREATEST(last_run, VALUES(last_run))`, key, scheduled)
+	return err
+}
+
+// 保存在锁目录下的 job.lastrun 文件中, 适用于同一主机上的多个进程
+type fileStore struct{}
+
+func FileStore() Store {
+	return fileStore{}
+}
+
+func (fileStore) LastRun(_ context.Context, job string) (time.Time, error) {
+	path, err := file.Path(job, ".lastrun")
+	if err != nil {
+		return time.Time{}, err
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, string(b))
+}
+
+func (fileStore) SetLastRun(ctx context.Context, job string, scheduled time.Time) error {
+	path, err := file.Path(job, ".lastrun")
+	if err != nil {
+		return err
+	}
+	return file.Update(ctx, path, func(old []byte) ([]byte, error) {
+		// 内容损坏时直接覆盖
+		if last, err := time.Parse(time.RFC3339Nano, string(old)); err == nil && !last.Before(scheduled) {
+			return old, nil
+		}
+		return []byte(scheduled.Format(time.RFC3339Nano)), nil
+	})
+}